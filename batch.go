@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// batchFailure records a script line whose command failed.
+type batchFailure struct {
+	Line    int    // Line is the line number in the script
+	Command string // Command is the line as written
+	Err     error  // Err is why it failed
+}
+
+// batchSummary is printed at the end of a script run.
+type batchSummary struct {
+	Succeeded int
+	Failed    []batchFailure
+	Stopped   bool // Stopped is true when the run ended early because of an error
+}
+
+// newBatchPrompter returns a prompter that never waits for input. Every value
+// a command needs must be on its script line; a prompt with nothing left to
+// answer it fails the command instead of reading the next line of the script.
+func newBatchPrompter() *prompter {
+	return &prompter{
+		readLine: func(req lineRequest) (string, error) {
+			label := strings.TrimRight(strings.TrimSpace(req.label), ":")
+			return "", fmt.Errorf("missing argument for %q", label)
+		},
+		out: os.Stdout,
+	}
+}
+
+// runScript runs every command in r through the same dispatcher as the menu.
+// Blank lines and lines starting with # are skipped.
+func runScript(r io.Reader, stopOnError bool) batchSummary {
+	summary := batchSummary{}
+	p := newBatchPrompter()
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fmt.Println(">", line)
+		exit, err := runCommand(p, line)
+		if err != nil {
+			fmt.Println("Error:", err)
+			summary.Failed = append(summary.Failed, batchFailure{Line: lineNumber, Command: line, Err: err})
+			if stopOnError {
+				summary.Stopped = true
+				break
+			}
+		} else {
+			summary.Succeeded++
+		}
+		if exit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		summary.Failed = append(summary.Failed, batchFailure{Line: lineNumber + 1, Err: err})
+	}
+	return summary
+}
+
+func printBatchSummary(summary batchSummary) {
+	fmt.Printf("\n%d command(s) succeeded, %d failed.\n", summary.Succeeded, len(summary.Failed))
+	for _, failure := range summary.Failed {
+		fmt.Printf("  line %d: %s: %v\n", failure.Line, failure.Command, failure.Err)
+	}
+	if summary.Stopped {
+		fmt.Println("Stopped at the first error.")
+	}
+}
+
+// runBatch handles "run [-stop-on-error] [file]". Without a file, or with "-",
+// commands are read from stdin. It returns the process exit code.
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	stopOnError := flags.Bool("stop-on-error", false, "stop at the first command that fails")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: library-cli run [-stop-on-error] [script file|-]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	input := io.Reader(os.Stdin)
+	if path := flags.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error opening script:", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	summary := runScript(input, *stopOnError)
+	printBatchSummary(summary)
+	if len(summary.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bookFields are the book fields UPDATE can change, in the order it asks for them.
+var bookFields = []string{"title", "author", "isbn", "publisher", "year"}
+
+// bookFieldLabels are the names shown in prompts.
+var bookFieldLabels = map[string]string{
+	"title":     "Title",
+	"author":    "Author",
+	"isbn":      "ISBN",
+	"publisher": "Publisher",
+	"year":      "Year",
+}
+
+// getBookField returns a field of book as text, "" when it is not set.
+func getBookField(book Book, field string) string {
+	switch field {
+	case "title":
+		return book.Title
+	case "author":
+		return book.Author
+	case "isbn":
+		return book.ISBN
+	case "publisher":
+		return book.Publisher
+	case "year":
+		if book.Year == 0 {
+			return ""
+		}
+		return strconv.Itoa(book.Year)
+	}
+	return ""
+}
+
+// setBookField parses value and stores it in the named field of book.
+// An empty value clears optional fields; title and author can't be cleared.
+// Text is normalized the same way as for new books (see normalizeText).
+func setBookField(book *Book, field, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch field {
+	case "title":
+		book.Title, err = checkText("title", value, true, maxTitleLength)
+	case "author":
+		book.Author, err = checkText("author", value, true, maxAuthorLength)
+	case "isbn":
+		if value != "" && !validISBN(cleanISBN(value)) {
+			return fmt.Errorf("%q is not a valid ISBN", value)
+		}
+		book.ISBN = cleanISBN(value)
+	case "publisher":
+		book.Publisher, err = checkText("publisher", value, false, maxPublisherLength)
+	case "year":
+		if value == "" {
+			book.Year = 0
+			return nil
+		}
+		year, err := strconv.Atoi(value)
+		if err != nil || year < 0 {
+			return fmt.Errorf("%q is not a valid year", value)
+		}
+		book.Year = year
+	default:
+		return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(bookFields, ", "))
+	}
+	return err
+}
+
+// printBookDetails shows every field of book, one per line.
+func printBookDetails(book Book) {
+	fmt.Printf("Book %d\n", book.ID)
+	for _, field := range bookFields {
+		value := getBookField(book, field)
+		if value == "" {
+			value = "none"
+		}
+		fmt.Printf("  %-10s %s\n", bookFieldLabels[field]+":", value)
+	}
+}
+
+// parseAssignment splits "author=New Name" into its field and value.
+func parseAssignment(arg string) (field, value string, err error) {
+	field, value, found := strings.Cut(arg, "=")
+	if !found {
+		return "", "", fmt.Errorf("expected field=value, got %q", arg)
+	}
+	return strings.ToLower(strings.TrimSpace(field)), value, nil
+}
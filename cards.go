@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Library cards are the size of a bank card (ID-1), in millimetres.
+const (
+	cardWidth  = 85.6
+	cardHeight = 54.0
+)
+
+// qrQuiet is the blank border, in modules, a scanner needs around a QR code.
+const qrQuiet = 4
+
+// luhnDigit returns the check digit that makes digits pass the Luhn check,
+// so a mistyped card number doesn't find somebody else's card.
+func luhnDigit(digits string) int {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 { // Every second digit from the right, starting with the last
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// nextCardNumber returns the next free card number: P, six digits and a
+// check digit, e.g. P0000018.
+func nextCardNumber() string {
+	highest := 0
+	for _, v := range visitors {
+		digits, found := strings.CutPrefix(v.Card, "P")
+		if n, err := strconv.Atoi(digits); found && err == nil && len(digits) == 7 && n/10 > highest {
+			highest = n / 10
+		}
+	}
+	digits := fmt.Sprintf("%06d", highest+1)
+	return "P" + digits + strconv.Itoa(luhnDigit(digits))
+}
+
+// visitorByCard returns the ID of the visitor with card number card.
+func visitorByCard(card string) (int, bool) {
+	card = normalizeBarcode(card)
+	for _, id := range sortedVisitorIDs() {
+		if visitors[id].Card != "" && visitors[id].Card == card {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// issueCard returns visitor vid's card number, giving them one first if
+// they were added before cards existed.
+func issueCard(vid int) (card string, issued bool, err error) {
+	visitor, exists := visitors[vid]
+	if !exists {
+		return "", false, errors.New("visitor not found")
+	}
+	if visitor.Card != "" {
+		return visitor.Card, false, nil
+	}
+	visitor.Card = nextCardNumber()
+	visitors[vid] = visitor
+	saveVisitors()
+	return visitor.Card, true, nil
+}
+
+// qrShapes draws code as squares in the box at left, top of size x size
+// millimetres, quiet zone included.
+func qrShapes(code qrCode, left, top, size float64) []labelShape {
+	module := size / float64(code.Size+2*qrQuiet)
+	squares := []labelShape{}
+	for y, row := range code.Modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// One rectangle per run of dark modules keeps the file small
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			squares = append(squares, labelShape{
+				X: left + float64(qrQuiet+x)*module,
+				Y: top + float64(qrQuiet+y)*module,
+				W: float64(run) * module,
+				H: module,
+			})
+			x += run - 1
+		}
+	}
+	return squares
+}
+
+// cardShapes lays out the front of visitor v's card: their name and card
+// number, the number as a barcode for the desk scanner and as a QR code.
+func cardShapes(v Visitor) ([]labelShape, error) {
+	code, err := encodeQR([]byte(v.Card))
+	if err != nil {
+		return nil, err
+	}
+	const margin, line = 5.0, 0.2
+	shapes := []labelShape{
+		// A thin frame to cut along
+		{X: 0, Y: 0, W: cardWidth, H: line},
+		{X: 0, Y: cardHeight - line, W: cardWidth, H: line},
+		{X: 0, Y: 0, W: line, H: cardHeight},
+		{X: cardWidth - line, Y: 0, W: line, H: cardHeight},
+		{Text: "LIBRARY CARD", X: margin, Y: margin + 4, FontSize: 3.5, Bold: true},
+		{Text: shorten(v.Name, 18), X: margin, Y: 21, FontSize: 4.5, Bold: true},
+		{Text: "Card number", X: margin, Y: 28, FontSize: 2.8},
+		{Text: v.Card, X: margin, Y: 33.5, FontSize: 4.5, Monospaced: true},
+	}
+	bars, _, err := barcodeShapes(v.Card, margin-2, 38, 46, 10)
+	if err != nil {
+		return nil, err
+	}
+	shapes = append(shapes, bars...)
+	qrSize := 30.0
+	shapes = append(shapes, qrShapes(code, cardWidth-margin-qrSize, (cardHeight-qrSize)/2, qrSize)...)
+	return shapes, nil
+}
+
+// writeQRPNG draws code as a black and white PNG with scale pixels per module.
+func writeQRPNG(w io.Writer, code qrCode, scale int) error {
+	size := (code.Size + 2*qrQuiet) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for y, row := range code.Modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((qrQuiet+x)*scale+dx, (qrQuiet+y)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// writeCard saves visitor v's card at path: .svg gives the printable card,
+// .png just its QR code, e.g. for a phone or a card printer's own software.
+func writeCard(v Visitor, path string) error {
+	var write func(w io.Writer) error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".svg":
+		shapes, err := cardShapes(v)
+		if err != nil {
+			return err
+		}
+		write = func(w io.Writer) error { return writeSVG(w, cardWidth, cardHeight, shapes) }
+	case ".png":
+		code, err := encodeQR([]byte(v.Card))
+		if err != nil {
+			return err
+		}
+		write = func(w io.Writer) error { return writeQRPNG(w, code, 10) }
+	default:
+		return fmt.Errorf("unknown card format %q, use a .svg or .png file", ext)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return write(file)
+}
+
+// handleCard prints a visitor's library card, issuing a number if they have none.
+func handleCard(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID or card number: ")
+	if err != nil {
+		return err
+	}
+	card, issued, err := issueCard(vid)
+	if err != nil {
+		return err
+	}
+	if issued {
+		fmt.Printf("Card number %s issued to %s.\n", card, visitors[vid].Name)
+	}
+
+	path, err := p.line(fmt.Sprintf("Output file (.svg or .png, Enter for card-%s.svg): ", card))
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "card-" + card + ".svg"
+	}
+	if err := writeCard(visitors[vid], path); err != nil {
+		return fmt.Errorf("writing card: %w", err)
+	}
+	fmt.Printf("Card of %s written to %s.\n", visitors[vid].Name, path)
+	return nil
+}
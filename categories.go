@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Category holds the borrowing rules for one kind of visitor.
+type Category struct {
+	MaxLoans int `json:"max_loans"` // MaxLoans is how many books a visitor may have at once
+	LoanDays int `json:"loan_days"` // LoanDays is how long a loan lasts before it is due
+	Renewals int `json:"renewals"`  // Renewals is how many times one loan may be extended
+}
+
+const defaultCategory = "adult" // defaultCategory applies to visitors without a category
+
+var categoriesFile = "categories.json" // categoriesFile can override or add categories without recompiling
+
+// categories are the rules for each visitor category. The file, if present,
+// replaces the rules of the categories it lists and adds new ones.
+var categories = map[string]Category{
+	"child":      {MaxLoans: 3, LoanDays: 14, Renewals: 1},
+	"adult":      {MaxLoans: 5, LoanDays: 21, Renewals: 2},
+	"staff":      {MaxLoans: 10, LoanDays: 42, Renewals: 3},
+	"researcher": {MaxLoans: 20, LoanDays: 90, Renewals: 5},
+}
+
+func loadCategories() {
+	data, err := os.ReadFile(categoriesFile)
+	if err != nil {
+		return // The built-in rules apply
+	}
+	custom := make(map[string]Category)
+	if err := json.Unmarshal(data, &custom); err != nil {
+		fmt.Println("Error reading categories, using the built-in rules:", err)
+		return
+	}
+	for name, rules := range custom {
+		if rules.MaxLoans < 0 || rules.LoanDays <= 0 || rules.Renewals < 0 {
+			fmt.Printf("Ignoring category %q in %s: limits must not be negative and loan_days must be at least 1\n", name, categoriesFile)
+			continue
+		}
+		categories[strings.ToLower(name)] = rules
+	}
+}
+
+// categoryNames returns the category names in alphabetical order.
+func categoryNames() []string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// visitorCategory returns the name and rules of v's category. Visitors
+// without a category, or with one that is no longer configured, are adults.
+func visitorCategory(v Visitor) (string, Category) {
+	if rules, found := categories[v.Category]; found {
+		return v.Category, rules
+	}
+	return defaultCategory, categories[defaultCategory]
+}
+
+// checkLoanLimit returns an error explaining why v can't borrow another book.
+func checkLoanLimit(v Visitor) error {
+	name, rules := visitorCategory(v)
+	if len(v.RentedIDs) >= rules.MaxLoans {
+		return fmt.Errorf("%s already has %d book(s) on loan, the most for the %s category is %d",
+			v.Name, len(v.RentedIDs), name, rules.MaxLoans)
+	}
+	return nil
+}
+
+// handleCategory sets a visitor's category.
+func handleCategory(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	visitor, exists := visitors[vid]
+	if !exists {
+		return errors.New("visitor not found")
+	}
+	current, _ := visitorCategory(visitor)
+	fmt.Printf("%s is in the %s category.\n", visitor.Name, current)
+	for _, name := range categoryNames() {
+		rules := categories[name]
+		fmt.Printf("  %-12s up to %d books, %d days, %d renewal(s)\n", name, rules.MaxLoans, rules.LoanDays, rules.Renewals)
+	}
+
+	name, err := p.choice("New category: ", categoryNames())
+	if err != nil {
+		return err
+	}
+	visitor.Category = name
+	visitors[vid] = visitor
+	saveVisitors()
+	fmt.Printf("%s is now in the %s category.\n", visitor.Name, name)
+	if rules := categories[name]; len(visitor.RentedIDs) > rules.MaxLoans {
+		fmt.Printf("Note: they have %d books on loan, more than the %d allowed; they can't rent more until some are returned.\n",
+			len(visitor.RentedIDs), rules.MaxLoans)
+	}
+	return nil
+}
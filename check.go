@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkIssue is one inconsistency found by CHECK.
+type checkIssue struct {
+	File    string // File is the data file the problem is in
+	Problem string // Problem describes what is wrong
+	Fix     string // Fix describes what --repair does about it, "" when it has to be fixed by hand
+	repair  func() // repair fixes the problem in memory; nil when Fix is ""
+}
+
+// duplicateKeys returns the top-level keys that appear more than once in the
+// JSON object in data. Unmarshal silently keeps only the last of them.
+func duplicateKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	seen := make(map[string]int)
+	duplicates := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		if seen[key]++; seen[key] == 2 {
+			duplicates = append(duplicates, key)
+		}
+		var value json.RawMessage // Skip the value
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+	return duplicates, nil
+}
+
+// checkFile looks for problems in the raw file that loading hides. into
+// points to what the file holds, such as a *[]Hold. It returns false when
+// the file can't be loaded into it at all.
+func checkFile(path string, into any) ([]checkIssue, bool) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, true // Nothing saved yet
+	}
+	if err != nil {
+		return []checkIssue{{File: path, Problem: fmt.Sprintf("can't be read: %v", err)}}, false
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return []checkIssue{{File: path, Problem: fmt.Sprintf("can't be loaded: %v", err)}}, false
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return nil, true // A list has no keys to repeat
+	}
+	duplicates, err := duplicateKeys(data)
+	if err != nil {
+		return []checkIssue{{File: path, Problem: fmt.Sprintf("is not valid JSON: %v", err)}}, false
+	}
+	issues := []checkIssue{}
+	for _, key := range duplicates {
+		issues = append(issues, checkIssue{
+			File:    path,
+			Problem: fmt.Sprintf("entry %s appears more than once, only the last one is used", key),
+			Fix:     "rewrite the file with the entry that is used",
+			repair:  func() {}, // Saving the file is the fix
+		})
+	}
+	return issues, true
+}
+
+// checkData scans books, visitors, holds and copies for inconsistencies.
+// readable is false when a data file couldn't be parsed, in which case
+// nothing may be repaired because saving would overwrite the file with what
+// little was loaded.
+func checkData() (issues []checkIssue, readable bool) {
+	readable = true
+	dataFiles := []struct {
+		path string
+		into any
+	}{
+		{dataFile, &map[int]Book{}},
+		{visitorsFile, &map[int]Visitor{}},
+		{holdsFile, &[]Hold{}},
+		{itemsFile, &map[string]Item{}},
+	}
+	for _, file := range dataFiles {
+		fileIssues, ok := checkFile(file.path, file.into)
+		issues = append(issues, fileIssues...)
+		readable = readable && ok
+	}
+
+	// Books: the map key is the ID everything else refers to
+	embedded := make(map[int][]int) // embedded maps an embedded ID to the keys of the books carrying it
+	maxBookID := 0
+	for _, key := range sortedBookIDs() {
+		book := books[key]
+		if book.ID != key {
+			issues = append(issues, checkIssue{
+				File:    dataFile,
+				Problem: fmt.Sprintf("book %d has ID %d inside", key, book.ID),
+				Fix:     fmt.Sprintf("set its ID to %d", key),
+				repair: func() {
+					b := books[key]
+					b.ID = key
+					books[key] = b
+				},
+			})
+		}
+		embedded[book.ID] = append(embedded[book.ID], key)
+		maxBookID = max(maxBookID, key, book.ID)
+		if _, err := validateBook(book); err != nil {
+			issues = append(issues, checkIssue{File: dataFile, Problem: fmt.Sprintf("book %d: %v", key, err)})
+		}
+	}
+	for _, id := range sortedKeys(embedded) {
+		if keys := embedded[id]; len(keys) > 1 {
+			issues = append(issues, checkIssue{
+				File:    dataFile,
+				Problem: fmt.Sprintf("books %s all have ID %d inside", joinIDs(keys), id),
+				Fix:     "each keeps its own key as its ID", // Done by the key mismatch repairs above
+				repair:  func() {},
+			})
+		}
+	}
+	if nextID <= maxBookID {
+		issues = append(issues, checkIssue{
+			File:    dataFile,
+			Problem: fmt.Sprintf("the next book ID %d is not above the highest ID in use (%d)", nextID, maxBookID),
+			Fix:     fmt.Sprintf("continue from %d", maxBookID+1),
+			repair:  func() { nextID = maxBookID + 1 },
+		})
+	}
+
+	// Visitors
+	maxVisitorID := 0
+	cardOwners := make(map[string]int)
+	for _, key := range sortedVisitorIDs() {
+		v := visitors[key]
+		if v.ID != key {
+			issues = append(issues, checkIssue{
+				File:    visitorsFile,
+				Problem: fmt.Sprintf("visitor %d has ID %d inside", key, v.ID),
+				Fix:     fmt.Sprintf("set their ID to %d", key),
+				repair: func() {
+					visitor := visitors[key]
+					visitor.ID = key
+					visitors[key] = visitor
+				},
+			})
+		}
+		maxVisitorID = max(maxVisitorID, key, v.ID)
+		if _, err := validateVisitor(v); err != nil {
+			issues = append(issues, checkIssue{File: visitorsFile, Problem: fmt.Sprintf("visitor %d: %v", key, err)})
+		}
+
+		seen := make(map[int]bool)
+		for _, bid := range v.RentedIDs {
+			switch {
+			case seen[bid]:
+				issues = append(issues, checkIssue{
+					File:    visitorsFile,
+					Problem: fmt.Sprintf("visitor %d lists book %d more than once", key, bid),
+					Fix:     "keep one entry",
+					repair:  func() { removeRental(key, bid, true) },
+				})
+			case !bookExists(bid):
+				issues = append(issues, checkIssue{
+					File:    visitorsFile,
+					Problem: fmt.Sprintf("visitor %d is renting book %d, which doesn't exist", key, bid),
+					Fix:     "remove the rental",
+					repair:  func() { removeRental(key, bid, false) },
+				})
+			}
+			seen[bid] = true
+		}
+		for _, loan := range v.Loans {
+			if !seen[loan.BookID] {
+				bid := loan.BookID
+				issues = append(issues, checkIssue{
+					File:    visitorsFile,
+					Problem: fmt.Sprintf("visitor %d has a due date for book %d but isn't renting it", key, bid),
+					Fix:     "remove the due date",
+					repair:  func() { removeRental(key, bid, false) },
+				})
+			}
+		}
+		if !v.Joined.IsZero() && !v.Expires.IsZero() && v.Expires.Before(v.Joined) {
+			issues = append(issues, checkIssue{File: visitorsFile, Problem: fmt.Sprintf("visitor %d's membership expires on %s, before they joined on %s", key, formatDate(v.Expires), formatDate(v.Joined))})
+		}
+		if owner, taken := cardOwners[v.Card]; taken {
+			issues = append(issues, checkIssue{
+				File:    visitorsFile,
+				Problem: fmt.Sprintf("visitor %d has card %s, which visitor %d has too", key, v.Card, owner),
+				Fix:     fmt.Sprintf("give visitor %d a new card number", key),
+				repair: func() {
+					visitor := visitors[key]
+					visitor.Card = nextCardNumber()
+					visitors[key] = visitor
+				},
+			})
+		} else if v.Card != "" {
+			cardOwners[v.Card] = key
+		}
+		if _, found := categories[v.Category]; v.Category != "" && !found {
+			issues = append(issues, checkIssue{File: visitorsFile, Problem: fmt.Sprintf("visitor %d has unknown category %q and is treated as %s", key, v.Category, defaultCategory)})
+		}
+	}
+	if nextVisitorID <= maxVisitorID {
+		issues = append(issues, checkIssue{
+			File:    visitorsFile,
+			Problem: fmt.Sprintf("the next visitor ID %d is not above the highest ID in use (%d)", nextVisitorID, maxVisitorID),
+			Fix:     fmt.Sprintf("continue from %d", maxVisitorID+1),
+			repair:  func() { nextVisitorID = maxVisitorID + 1 },
+		})
+	}
+
+	// Holds must point at a book and a visitor that exist, and not at a book the visitor already has
+	for _, h := range holds {
+		problem := ""
+		switch {
+		case !bookExists(h.BookID):
+			problem = fmt.Sprintf("hold of visitor %d is for book %d, which doesn't exist", h.VisitorID, h.BookID)
+		case !visitorExists(h.VisitorID):
+			problem = fmt.Sprintf("hold on book %d is for visitor %d, who doesn't exist", h.BookID, h.VisitorID)
+		case isRenting(h.VisitorID, h.BookID):
+			problem = fmt.Sprintf("visitor %d holds book %d they are already renting", h.VisitorID, h.BookID)
+		default:
+			continue
+		}
+		issues = append(issues, checkIssue{
+			File:    holdsFile,
+			Problem: problem,
+			Fix:     "remove the hold",
+			repair: func() {
+				removeHolds(func(other Hold) bool { return other.BookID == h.BookID && other.VisitorID == h.VisitorID })
+			},
+		})
+	}
+
+	// Copies must belong to a book, and "on loan" must match the loans
+	for _, barcode := range sortedBarcodes() {
+		item := items[barcode]
+		_, _, lent := itemLoan(barcode)
+		switch {
+		case !bookExists(item.BookID):
+			issues = append(issues, checkIssue{
+				File:    itemsFile,
+				Problem: fmt.Sprintf("copy %s is of book %d, which doesn't exist", barcode, item.BookID),
+				Fix:     "remove the copy",
+				repair:  func() { delete(items, barcode) },
+			})
+		case !slices.Contains(itemStatuses, item.Status):
+			issues = append(issues, checkIssue{File: itemsFile, Problem: fmt.Sprintf("copy %s has unknown status %q", barcode, item.Status)})
+		case item.Status == statusOnLoan && !lent && bookRenter(item.BookID) == 0:
+			issues = append(issues, checkIssue{
+				File:    itemsFile,
+				Problem: fmt.Sprintf("copy %s is marked on loan but nobody has it", barcode),
+				Fix:     "mark it available",
+				repair:  func() { setItemStatus(barcode, statusAvailable) },
+			})
+		case item.Status != statusOnLoan && lent:
+			issues = append(issues, checkIssue{
+				File:    itemsFile,
+				Problem: fmt.Sprintf("copy %s is lent but marked %s", barcode, item.Status),
+				Fix:     "mark it on loan",
+				repair:  func() { setItemStatus(barcode, statusOnLoan) },
+			})
+		case barcodeLooksLikeID(barcode):
+			issues = append(issues, checkIssue{File: itemsFile, Problem: fmt.Sprintf("copy %s has a barcode that RENT and RETURN take for a book ID; give the copy a new label", barcode)})
+		}
+	}
+	for _, vid := range sortedVisitorIDs() {
+		for _, loan := range visitors[vid].Loans {
+			if item, exists := items[loan.Barcode]; loan.Barcode != "" && (!exists || item.BookID != loan.BookID) {
+				issues = append(issues, checkIssue{
+					File:    visitorsFile,
+					Problem: fmt.Sprintf("visitor %d has copy %s, which is not a copy of book %d", vid, loan.Barcode, loan.BookID),
+					Fix:     "forget which copy was lent",
+					repair:  func() { unlinkLoan(vid, loan.Barcode) },
+				})
+			}
+		}
+	}
+
+	for _, entry := range ledger {
+		if !visitorExists(entry.VisitorID) {
+			issues = append(issues, checkIssue{File: ledgerFile, Problem: fmt.Sprintf("%s %s on %s is for visitor %d, who doesn't exist",
+				entry.Kind, formatMoney(entry.Amount), entry.Time.Format("2006-01-02"), entry.VisitorID)})
+		}
+	}
+	return issues, readable
+}
+
+func sortedBarcodes() []string {
+	barcodes := make([]string, 0, len(items))
+	for barcode := range items {
+		barcodes = append(barcodes, barcode)
+	}
+	sort.Strings(barcodes)
+	return barcodes
+}
+
+func setItemStatus(barcode, status string) {
+	item := items[barcode]
+	item.Status = status
+	items[barcode] = item
+}
+
+// unlinkLoan clears the barcode of visitor vid's loan of that copy.
+func unlinkLoan(vid int, barcode string) {
+	v := visitors[vid]
+	for i := range v.Loans {
+		if v.Loans[i].Barcode == barcode {
+			v.Loans[i].Barcode = ""
+		}
+	}
+	visitors[vid] = v
+}
+
+func visitorExists(id int) bool {
+	_, exists := visitors[id]
+	return exists
+}
+
+func bookExists(id int) bool {
+	_, exists := books[id]
+	return exists
+}
+
+// removeRental drops book bid from visitor vid's rentals and its due date.
+// With keepOne, the first entry and the due date stay and only the repeats go.
+func removeRental(vid, bid int, keepOne bool) {
+	v := visitors[vid]
+	rented := []int{}
+	kept := false
+	for _, id := range v.RentedIDs {
+		if id == bid && (!keepOne || kept) {
+			continue
+		}
+		if id == bid {
+			kept = true
+		}
+		rented = append(rented, id)
+	}
+	v.RentedIDs = rented
+	if !keepOne {
+		if i := findLoan(v, bid); i != -1 {
+			v.Loans = append(v.Loans[:i], v.Loans[i+1:]...)
+		}
+	}
+	visitors[vid] = v
+}
+
+func sortedKeys(m map[int][]int) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func joinIDs(ids []int) string {
+	sort.Ints(ids)
+	text := make([]string, len(ids))
+	for i, id := range ids {
+		text[i] = fmt.Sprint(id)
+	}
+	return strings.Join(text, ", ")
+}
+
+// backupFile copies path next to itself with the time in the name and
+// returns the copy's name. A number is added if a backup was already made
+// that second. A missing file needs no backup.
+func backupFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	stamp := path + ".bak-" + time.Now().Format("20060102-150405")
+	backup := stamp
+	for n := 2; ; n++ {
+		file, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			backup = fmt.Sprintf("%s-%d", stamp, n)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return backup, err
+	}
+}
+
+// printCheckReport lists the issues and returns how many --repair can fix.
+func printCheckReport(w io.Writer, issues []checkIssue) int {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "No problems found.")
+		return 0
+	}
+	fixable := 0
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s: %s\n", issue.File, issue.Problem)
+		if issue.Fix != "" {
+			fmt.Fprintf(w, "    repair: %s\n", issue.Fix)
+			fixable++
+		} else {
+			fmt.Fprintln(w, "    repair: fix by hand (e.g. UPDATE, CATEGORY, DEDUPE or DELETE)")
+		}
+	}
+	fmt.Fprintf(w, "\n%d problem(s) found, %d can be repaired.\n", len(issues), fixable)
+	return fixable
+}
+
+// repairData applies every fix after backing up the books, visitors, holds
+// and copies files, which are all rewritten.
+func repairData(issues []checkIssue) error {
+	if !dryRunMode {
+		for _, path := range []string{dataFile, visitorsFile, holdsFile, itemsFile} {
+			backup, err := backupFile(path)
+			if err != nil {
+				return fmt.Errorf("could not back up %s, nothing was changed: %w", path, err)
+			}
+			if backup != "" {
+				fmt.Println("Backed up", path, "to", backup)
+			}
+		}
+	}
+	repaired := 0
+	for _, issue := range issues {
+		if issue.repair != nil {
+			issue.repair()
+			repaired++
+		}
+	}
+	saveBooks()
+	saveVisitors()
+	if _, err := os.Stat(holdsFile); err == nil {
+		saveHolds()
+	}
+	if _, err := os.Stat(itemsFile); err == nil {
+		saveItems()
+	}
+	fmt.Printf("%d problem(s) repaired.\n", repaired)
+	return nil
+}
+
+// runCheck reports problems and, when repair is true, fixes them.
+func runCheck(repair bool) error {
+	issues, readable := checkData()
+	fixable := printCheckReport(os.Stdout, issues)
+	if fixable == 0 {
+		return nil
+	}
+	if !repair {
+		fmt.Println("Run CHECK --repair to fix them (the data files are backed up first).")
+		return nil
+	}
+	if !readable {
+		return errors.New("a data file could not be read, fix it by hand before repairing")
+	}
+	return repairData(issues)
+}
+
+// handleCheck is the CHECK menu command: "CHECK" reports, "CHECK --repair" also fixes.
+func handleCheck(p *prompter) error {
+	repair := false
+	if p.hasArgs() {
+		option, err := p.line("Option: ")
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(option) {
+		case "--repair", "-repair", "repair":
+			repair = true
+		default:
+			return fmt.Errorf("unknown option %q, expected --repair", option)
+		}
+	}
+	return runCheck(repair)
+}
+
+// checkMain handles "check [-repair]" from the command line. It returns the
+// process exit code: 1 when problems are left unfixed.
+func checkMain(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "fix what can be fixed, after backing up the data files")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if err := runCheck(*repair); err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	if issues, _ := checkData(); len(issues) > 0 {
+		return 1 // Some problems are left, either not repaired or only fixable by hand
+	}
+	return 0
+}
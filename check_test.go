@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBackupFileNamesDontCollide(t *testing.T) {
+	testLibrary(t, testStart)
+	if err := os.WriteFile(dataFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for range 3 {
+		backup, err := backupFile(dataFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[backup] {
+			t.Fatalf("backup %s was made twice", backup)
+		}
+		seen[backup] = true
+		if data, err := os.ReadFile(backup); err != nil || string(data) != "{}" {
+			t.Errorf("%s holds %q, %v", backup, data, err)
+		}
+	}
+}
+
+func TestRepairRefusedWhenAFileIsUnreadable(t *testing.T) {
+	for _, path := range []string{holdsFile, itemsFile} {
+		t.Run(path, func(t *testing.T) {
+			testLibrary(t, testStart)
+			books[1] = Book{ID: 5, Title: "Dune", Author: "Test Author"} // Fixable: the ID inside is wrong
+			saveBooks()
+			before, err := os.ReadFile(dataFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = runCheck(true)
+			if err == nil || !strings.Contains(err.Error(), "could not be read") {
+				t.Fatalf("runCheck(true) = %v, want a refusal", err)
+			}
+			if after, _ := os.ReadFile(dataFile); string(after) != string(before) {
+				t.Errorf("%s was rewritten although %s is broken", dataFile, path)
+			}
+			if data, _ := os.ReadFile(path); string(data) != "{not json" {
+				t.Errorf("%s was overwritten with %q", path, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// citationFormats lists the formats CITE understands.
+var citationFormats = []string{"bibtex", "ris"}
+
+// authorSurname guesses the family name of an author written as "Frank Herbert" or "Herbert, Frank".
+func authorSurname(author string) string {
+	author = strings.TrimSpace(author)
+	if before, _, found := strings.Cut(author, ","); found {
+		return strings.TrimSpace(before)
+	}
+	words := strings.Fields(author)
+	if len(words) == 0 {
+		return ""
+	}
+	return words[len(words)-1]
+}
+
+// baseCitationKey builds a key like "herbert1965" from the author's surname and the year.
+// Only ASCII letters and digits are kept so the key is safe in every BibTeX tool.
+func baseCitationKey(book Book) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(authorSurname(book.Author)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("anon")
+	}
+	if book.Year != 0 {
+		b.WriteString(strconv.Itoa(book.Year))
+	} else {
+		b.WriteString("nd") // "no date", the usual convention
+	}
+	return b.String()
+}
+
+// citationKeys assigns a key to every book. Books sharing a base key get a
+// suffix (a, b, c, ...) in book ID order, so a key never changes unless a
+// book with a lower ID and the same author and year is added.
+func citationKeys() map[int]string {
+	keys := make(map[int]string)
+	count := make(map[string]int)
+	for _, id := range sortedBookIDs() {
+		count[baseCitationKey(books[id])]++
+	}
+	used := make(map[string]int)
+	for _, id := range sortedBookIDs() {
+		base := baseCitationKey(books[id])
+		if count[base] == 1 {
+			keys[id] = base
+			continue
+		}
+		keys[id] = base + citationSuffix(used[base])
+		used[base]++
+	}
+	return keys
+}
+
+// citationSuffix returns a, b, ..., z, aa, ab, ... for n = 0, 1, 2, ...
+func citationSuffix(n int) string {
+	suffix := ""
+	for {
+		suffix = string(rune('a'+n%26)) + suffix
+		n = n/26 - 1
+		if n < 0 {
+			return suffix
+		}
+	}
+}
+
+// bibtexEscaper escapes characters that have a special meaning in BibTeX field values.
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+func writeBibTeX(w io.Writer, book Book, key string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@book{%s,\n", key)
+	fmt.Fprintf(&b, "  author = {%s},\n", bibtexEscaper.Replace(book.Author))
+	fmt.Fprintf(&b, "  title = {%s},\n", bibtexEscaper.Replace(book.Title))
+	if book.Publisher != "" {
+		fmt.Fprintf(&b, "  publisher = {%s},\n", bibtexEscaper.Replace(book.Publisher))
+	}
+	if book.Year != 0 {
+		fmt.Fprintf(&b, "  year = {%d},\n", book.Year)
+	}
+	if book.ISBN != "" {
+		fmt.Fprintf(&b, "  isbn = {%s},\n", bibtexEscaper.Replace(book.ISBN))
+	}
+	b.WriteString("}\n\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// risLine writes one RIS tag line. RIS values are single lines, so newlines are flattened.
+func risLine(b *strings.Builder, tag, value string) {
+	fmt.Fprintf(b, "%s  - %s\r\n", tag, strings.Join(strings.Fields(value), " "))
+}
+
+// writeRIS writes an RIS entry. The spec uses CRLF line endings.
+func writeRIS(w io.Writer, book Book, key string) error {
+	var b strings.Builder
+	risLine(&b, "TY", "BOOK")
+	risLine(&b, "ID", key)
+	risLine(&b, "AU", book.Author)
+	risLine(&b, "TI", book.Title)
+	if book.Publisher != "" {
+		risLine(&b, "PB", book.Publisher)
+	}
+	if book.Year != 0 {
+		risLine(&b, "PY", strconv.Itoa(book.Year))
+	}
+	if book.ISBN != "" {
+		risLine(&b, "SN", book.ISBN)
+	}
+	risLine(&b, "ER", "")
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCitations writes the books with the given IDs in format.
+func writeCitations(w io.Writer, ids []int, format string) error {
+	var write func(io.Writer, Book, string) error
+	switch format {
+	case "bibtex", "bib":
+		write = writeBibTeX
+	case "ris":
+		write = writeRIS
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(citationFormats, ", "))
+	}
+
+	keys := citationKeys()
+	for _, id := range ids {
+		book, exists := books[id]
+		if !exists {
+			return fmt.Errorf("book %d not found", id)
+		}
+		if err := write(w, book, keys[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// citeBooks writes citations for ids to path, or to stdout when path is empty.
+func citeBooks(ids []int, format, path string) error {
+	if path == "" {
+		return writeCitations(os.Stdout, ids, format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeCitations(file, ids, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d citation(s) to %s\n", len(ids), path)
+	return nil
+}
+
+func handleCite(p *prompter) error {
+	names := make(map[int]string)
+	for id, book := range books {
+		names[id] = book.Title
+	}
+	all := false // ALL is checked first, so it isn't taken for part of a title
+	id, err := p.idOr("Book ID or title to cite (or ALL): ", names, func(text string) (int, bool) {
+		all = strings.EqualFold(text, "all")
+		return 0, all
+	})
+	if err != nil {
+		return err
+	}
+	ids := []int{id}
+	if all {
+		ids = sortedBookIDs()
+	}
+
+	format, err := p.choice(fmt.Sprintf("Format (%s): ", strings.Join(citationFormats, "/")), citationFormats)
+	if err != nil {
+		return err
+	}
+
+	path, err := p.line("Output file (Enter to print here): ")
+	if err != nil {
+		return err
+	}
+
+	if err := citeBooks(ids, format, path); err != nil {
+		return fmt.Errorf("citing: %w", err)
+	}
+	p.waitForReturn()
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Clock tells the library what time it is. Due dates, fines and hold
+// deadlines all ask clock instead of calling time.Now, so a test (or the
+// hidden -now flag) can decide what "today" is.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// offsetClock runs at normal speed but starts from another moment.
+type offsetClock struct {
+	offset time.Duration // offset is added to the real time
+}
+
+func (c offsetClock) Now() time.Time { return time.Now().Add(c.offset) }
+
+var clock Clock = systemClock{} // clock is used for every time-dependent rule
+
+// parseNow reads the -now value: a date ("2026-10-30"), which keeps the
+// current time of day, or a date and time ("2026-10-30T15:04").
+func parseNow(value string) (time.Time, error) {
+	real := time.Now()
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return time.Date(day.Year(), day.Month(), day.Day(), real.Hour(), real.Minute(), real.Second(), 0, time.Local), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -now %q, expected e.g. 2026-10-30 or 2026-10-30T15:04", value)
+}
+
+// setNow makes the clock start from value instead of the real time.
+func setNow(value string) error {
+	now, err := parseNow(value)
+	if err != nil {
+		return err
+	}
+	clock = offsetClock{offset: time.Until(now)}
+	return nil
+}
+
+// hiddenFlags are left out of the usage message. They are meant for
+// reproducing problems, not for everyday use.
+var hiddenFlags = map[string]bool{"now": true}
+
+// printUsage is flag.Usage without the hidden flags.
+func printUsage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage of %s:\n", flag.CommandLine.Name())
+	visible := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+	visible.SetOutput(output)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fixedClock always returns the same moment, until Advance moves it forward.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+// Advance moves the clock forward by d.
+func (c *fixedClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// testLibrary gives a test an empty library in a temporary directory and a
+// fixed clock at start. Everything is put back when the test ends.
+func testLibrary(t *testing.T, start time.Time) *fixedClock {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	savedBooks, savedVisitors, savedItems := books, visitors, items
+	savedNextID, savedNextVisitorID := nextID, nextVisitorID
+	savedHolds, savedLedger, savedFees := holds, ledger, feeRules
+	savedSent, savedSettings, savedClock := sentReminders, reminderSettings, clock
+	t.Cleanup(func() {
+		books, visitors, items = savedBooks, savedVisitors, savedItems
+		nextID, nextVisitorID = savedNextID, savedNextVisitorID
+		holds, ledger, feeRules = savedHolds, savedLedger, savedFees
+		sentReminders, reminderSettings, clock = savedSent, savedSettings, savedClock
+	})
+
+	books, visitors, items = make(map[int]Book), make(map[int]Visitor), make(map[string]Item)
+	nextID, nextVisitorID = 1, 1
+	holds, ledger, sentReminders = nil, nil, nil
+	fake := &fixedClock{now: start}
+	clock = fake
+	return fake
+}
+
+// addTestBook and addTestVisitor add a record with the next free ID.
+func addTestBook(title string) int {
+	id := nextID
+	books[id] = Book{ID: id, Title: title, Author: "Test Author"}
+	nextID++
+	return id
+}
+
+func addTestVisitor(name string) int {
+	id := nextVisitorID
+	visitors[id] = Visitor{ID: id, Name: name, RentedIDs: []int{}}
+	nextVisitorID++
+	return id
+}
+
+var testStart = time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+func TestFixedClockAdvance(t *testing.T) {
+	c := &fixedClock{now: testStart}
+	c.Advance(36 * time.Hour)
+	if want := testStart.Add(36 * time.Hour); !c.Now().Equal(want) {
+		t.Errorf("Now() = %v, want %v", c.Now(), want)
+	}
+}
+
+func TestDueDateFollowsCategory(t *testing.T) {
+	testLibrary(t, testStart)
+	bid := addTestBook("Dune")
+	tests := []struct {
+		category string
+		days     int
+	}{
+		{"", categories[defaultCategory].LoanDays},
+		{"child", categories["child"].LoanDays},
+		{"researcher", categories["researcher"].LoanDays},
+	}
+	for _, test := range tests {
+		vid := addTestVisitor("Reader " + test.category)
+		v := visitors[vid]
+		v.Category = test.category
+		visitors[vid] = v
+
+		loan, err := rentCopy(vid, bid, "")
+		if err != nil {
+			t.Fatalf("renting to %q: %v", test.category, err)
+		}
+		if want := testStart.AddDate(0, 0, test.days); !loan.Due.Equal(want) || !loan.Rented.Equal(testStart) {
+			t.Errorf("category %q: rented %v, due %v; want rented %v, due %v", test.category, loan.Rented, loan.Due, testStart, want)
+		}
+		if _, err := returnBookFrom(vid, bid); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLateFineOnReturn(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Duration // after is the time between the due date and the return
+		fine  int
+	}{
+		{"on the due date", 0, 0},
+		{"an hour late", time.Hour, feeRules.DailyRate},
+		{"three days late", 3 * 24 * time.Hour, 3 * feeRules.DailyRate},
+		{"a year late", 365 * 24 * time.Hour, feeRules.MaxPerLoan},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := testLibrary(t, testStart)
+			bid, vid := addTestBook("Dune"), addTestVisitor("Ada")
+			loan, err := rentCopy(vid, bid, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake.Advance(loan.Due.Sub(fake.Now()) + test.after)
+
+			info, err := returnBookFrom(vid, bid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Fine != test.fine || balance(vid) != test.fine {
+				t.Errorf("fine %s, balance %s; want %s", formatMoney(info.Fine), formatMoney(balance(vid)), formatMoney(test.fine))
+			}
+		})
+	}
+}
+
+func TestHoldPickupExpires(t *testing.T) {
+	fake := testLibrary(t, testStart)
+	bid := addTestBook("Dune")
+	first, waiting, other := addTestVisitor("Ada"), addTestVisitor("Grace"), addTestVisitor("Alan")
+
+	if _, err := rentCopy(first, bid, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := placeHold(waiting, bid); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(24 * time.Hour)
+	info, err := returnBookFrom(first, bid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Holds) != 1 || info.Holds[0].VisitorID != waiting {
+		t.Fatalf("holds after the return = %+v, want one for visitor %d", info.Holds, waiting)
+	}
+	if want := fake.Now().AddDate(0, 0, holdPickupDays); !info.Holds[0].PickupBy.Equal(want) {
+		t.Errorf("pick up by %v, want %v", info.Holds[0].PickupBy, want)
+	}
+
+	// On the last pickup day the copy is still kept
+	fake.Advance(holdPickupDays * 24 * time.Hour)
+	if _, err := rentCopy(other, bid, ""); err == nil {
+		t.Fatal("rented a copy that is kept for someone else")
+	}
+	expireHolds()
+	if len(holds) != 1 {
+		t.Fatalf("hold expired too early: %+v", holds)
+	}
+
+	// A minute later it is free again
+	fake.Advance(time.Minute)
+	expireHolds()
+	if len(holds) != 0 {
+		t.Fatalf("hold did not expire: %+v", holds)
+	}
+	if _, err := rentCopy(other, bid, ""); err != nil {
+		t.Errorf("renting after the hold expired: %v", err)
+	}
+}
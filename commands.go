@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// commandInfo describes a menu command for HELP and Tab completion.
+type commandInfo struct {
+	Name    string // Name is what the user types, in upper case
+	Usage   string // Usage shows the optional inline arguments in prompt order
+	Summary string // Summary is a one-line description
+}
+
+// commandHelp lists every command in the order HELP shows them.
+// Arguments left out on the command line are asked for by prompts.
+var commandHelp = []commandInfo{
+	{"VISITORS", "VISITORS", "List all visitors and what they are renting."},
+	{"ADDVISITOR", "ADDVISITOR [name] [field=value ...] [confirm y/n]", "Register a new visitor with a card number and a membership of a year, e.g. ADDVISITOR \"Ada\" email=ada@example.com. A name like an existing one asks for confirmation."},
+	{"RENT", "RENT [visitor|card] [book|barcode ...]", "Rent one or more books to a visitor. IDs, names, titles, card numbers and copy barcodes are accepted."},
+	{"RETURN", "RETURN [visitor|card] [book|barcode ...]", "Return one or more books a visitor is renting."},
+	{"RECEIPT", "RECEIPT [file]", "Show the receipt of the last RENT or RETURN, or save it as .txt, .html or .pdf."},
+	{"RENEW", "RENEW [visitor] [book]", "Extend a loan by another loan period, if the visitor's category allows it."},
+	{"CATEGORY", "CATEGORY [visitor] [category]", "Set a visitor's category (child, adult, staff, researcher), which decides their borrowing limits."},
+	{"PAY", "PAY [visitor] [amount|ALL]", "Record a payment towards a visitor's late fees."},
+	{"WAIVE", "WAIVE [visitor] [amount|ALL] [reason]", "Cancel some or all of what a visitor owes."},
+	{"ACCOUNT", "ACCOUNT [visitor]", "Show a visitor's fines, payments and balance."},
+	{"PROFILE", "PROFILE [visitor|card] [field=value ...] [confirm y/n]", "Show or change a visitor's details, e.g. PROFILE 3 expires=2027-10-15. Fields: name, email, phone, address, joined, expires, notes."},
+	{"MEMBERSHIPS", "MEMBERSHIPS [days]", "List memberships that have expired or expire within the given days (30 by default). Expired members can't rent."},
+	{"TEMPLATES", "TEMPLATES", "Write the built-in reminder and receipt templates to the templates directory, to edit them."},
+	{"REMIND", "REMIND [confirm y/n]", "Send reminders about overdue books and books due soon, as set in reminders.json. Run \"library-cli remind\" to send them from a scheduled task."},
+	{"CARD", "CARD [visitor|card] [file]", "Save a visitor's library card with its QR code as .svg, or just the QR code as .png."},
+	{"HOLD", "HOLD [visitor] [book]", "Join the queue for a rented book. It is kept for the first in line when returned."},
+	{"HOLDS", "HOLDS", "List the hold queues by book and by visitor."},
+	{"CREATE", `CREATE [isbn|""] [title] [author] [confirm y/n]`, `Add a book. Give "" as the ISBN to skip the lookup. A likely duplicate asks for confirmation.`},
+	{"READ", "READ", "List all books with how many copies are available."},
+	{"SEARCH", "SEARCH [keyword]", "Find books whose title contains the keyword."},
+	{"UPDATE", `UPDATE [book] [field=value ...] [confirm y/n]`, `Change some fields of a book, e.g. UPDATE 5 author="New Name". Fields: title, author, isbn, publisher, year.`},
+	{"DELETE", "DELETE [book] [confirm y/n]", "Delete a book after showing it."},
+	{"ADDCOPY", `ADDCOPY [book] [barcode|""] [condition|""]`, `Register a physical copy of a book. Give "" for the next free barcode; a barcode needs at least one letter.`},
+	{"COPIES", "COPIES [book]", "List the copies of a book, their status and who has them."},
+	{"MARKCOPY", `MARKCOPY [barcode] [available|lost|repair] [condition|""]`, "Change the status of a copy that is not on loan."},
+	{"LABELS", "LABELS [books|barcodes|ALL] [file]", "Print Code128 barcode labels for copies on an A4 sheet of 3 x 8 labels, as SVG or PDF."},
+	{"IMPORT", "IMPORT [file] [mapping] [dry-run y/n]", "Import books from a CSV or JSON file. The mapping is only asked for CSV files."},
+	{"EXPORT", "EXPORT [books|visitors|loans] [format] [keyword] [file]", "Export data as CSV, JSON, Markdown or HTML."},
+	{"MARC", "MARC [import|export] [file] ...", "Import or export MARC21 (.mrc) and MARCXML (.xml) records."},
+	{"CITE", "CITE [book|ALL] [bibtex|ris] [file]", "Write BibTeX or RIS citations."},
+	{"DEDUPE", "DEDUPE [books|visitors] [keep ID|\"\"] [merge y/n] ...", "Find likely duplicate books or visitors and merge each group into the one you keep. Groups where one visitor borrowed several of the books are skipped."},
+	{"CHECK", "CHECK [--repair]", "Check the data files for inconsistencies; --repair fixes them after making a backup."},
+	{"TUI", "TUI", "Open the full-screen terminal UI."},
+	{"DRYRUN", "DRYRUN [on|off]", "Show changes without saving them to the data files. Turning it off drops those changes."},
+	{"HELP", "HELP [command]", "Show this list, or the syntax of one command."},
+	{"EXIT", "EXIT", "Quit the program."},
+}
+
+// commandNames are the commands the menu understands, offered by Tab completion.
+var commandNames = func() []string {
+	names := make([]string, len(commandHelp))
+	for i, info := range commandHelp {
+		names[i] = info.Name
+	}
+	return names
+}()
+
+// splitArgs splits a command line into words. Single or double quotes group
+// words ("lord of"), and a backslash escapes the next character inside double quotes.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	var word strings.Builder
+	inWord := false // inWord is true once the current word has started, so "" gives an empty argument
+	var quote rune  // quote is the open quote character, or 0
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '"' && r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("missing closing quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+func findCommand(name string) (commandInfo, bool) {
+	for _, info := range commandHelp {
+		if strings.EqualFold(info.Name, name) {
+			return info, true
+		}
+	}
+	return commandInfo{}, false
+}
+
+func handleHelp(p *prompter) error {
+	name, err := p.line("Command (Enter for all): ")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		for _, info := range commandHelp {
+			fmt.Printf("  %-12s %s\n", info.Name, info.Summary)
+		}
+		fmt.Println("\nArguments can be typed after a command, e.g. RENT 3 12 or SEARCH \"lord of\".")
+		fmt.Println("Anything left out is asked for. Type HELP <command> for its syntax.")
+		return nil
+	}
+	info, found := findCommand(name)
+	if !found {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	fmt.Println("Usage:", info.Usage)
+	fmt.Println(info.Summary)
+	return nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// duplicateClusters groups ids whose keys are equal and returns the groups
+// with more than one member, each sorted and ordered by their lowest ID.
+func duplicateClusters(ids []int, key func(id int) string) [][]int {
+	groups := make(map[string][]int)
+	for _, id := range ids {
+		k := key(id)
+		groups[k] = append(groups[k], id)
+	}
+	clusters := [][]int{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			sort.Ints(group)
+			clusters = append(clusters, group)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0] < clusters[j][0] })
+	return clusters
+}
+
+// bookClusters returns groups of books with the same normalized title and author.
+func bookClusters() [][]int {
+	return duplicateClusters(sortedBookIDs(), func(id int) string {
+		return bookKey(books[id].Title, books[id].Author)
+	})
+}
+
+// visitorClusters returns groups of visitors with the same normalized name.
+func visitorClusters() [][]int {
+	return duplicateClusters(sortedVisitorIDs(), func(id int) string {
+		return matchKey(visitors[id].Name)
+	})
+}
+
+// appendUnique appends id to ids unless it is already there.
+func appendUnique(ids []int, id int) []int {
+	if containsID(ids, id) {
+		return ids
+	}
+	return append(ids, id)
+}
+
+// bookMergeConflict returns an error when a visitor has borrowed more than one
+// of the books in ids. A visitor can only rent a book once, so merging them
+// would lose track of one of the copies.
+func bookMergeConflict(ids []int) error {
+	for _, vid := range sortedVisitorIDs() {
+		v := visitors[vid]
+		borrowed := []int{}
+		for _, id := range ids {
+			if findLoan(v, id) != -1 || containsID(v.RentedIDs, id) {
+				borrowed = append(borrowed, id)
+			}
+		}
+		if len(borrowed) > 1 {
+			return fmt.Errorf("%s (ID %d) has borrowed books %s; return all but one of them before merging", v.Name, v.ID, joinIDs(borrowed))
+		}
+	}
+	return nil
+}
+
+// visitorMergeConflict returns an error when more than one of the visitors in
+// ids is renting the same book, for the same reason as bookMergeConflict.
+func visitorMergeConflict(ids []int) error {
+	for _, bid := range sortedBookIDs() {
+		renters := []int{}
+		for _, id := range ids {
+			if v := visitors[id]; findLoan(v, bid) != -1 || containsID(v.RentedIDs, bid) {
+				renters = append(renters, id)
+			}
+		}
+		if len(renters) > 1 {
+			return fmt.Errorf("visitors %s are each renting %q (ID %d); return it for all but one of them before merging", joinIDs(renters), books[bid].Title, bid)
+		}
+	}
+	return nil
+}
+
+// containsID reports whether id is in ids.
+func containsID(ids []int, id int) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeBooks folds the books in others into survivor. Fields the survivor
+// doesn't have are taken from the duplicates, and every rental of a
+// duplicate is moved to the survivor. Both files are saved.
+func mergeBooks(survivor int, others []int) error {
+	book, exists := books[survivor]
+	if !exists {
+		return errors.New("book not found")
+	}
+	if err := bookMergeConflict(appendUnique(append([]int{}, others...), survivor)); err != nil {
+		return err
+	}
+	merged := make(map[int]bool)
+	for _, id := range others {
+		other, exists := books[id]
+		if !exists {
+			return fmt.Errorf("book %d not found", id)
+		}
+		if id == survivor {
+			continue
+		}
+		if book.ISBN == "" {
+			book.ISBN = other.ISBN
+		}
+		if book.Publisher == "" {
+			book.Publisher = other.Publisher
+		}
+		if book.Year == 0 {
+			book.Year = other.Year
+		}
+		merged[id] = true
+	}
+
+	// Point every rental of a duplicate at the survivor. bookMergeConflict
+	// made sure no visitor has borrowed two of them.
+	for vid, v := range visitors {
+		changed := false
+		rented := []int{}
+		for _, bid := range v.RentedIDs {
+			if merged[bid] {
+				bid = survivor
+				changed = true
+			}
+			rented = appendUnique(rented, bid)
+		}
+		if changed {
+			v.RentedIDs = rented
+			loans := []Loan{}
+			for _, loan := range v.Loans {
+				if merged[loan.BookID] {
+					loan.BookID = survivor
+				}
+				if findLoan(Visitor{Loans: loans}, loan.BookID) == -1 {
+					loans = append(loans, loan)
+				}
+			}
+			v.Loans = loans
+			visitors[vid] = v
+		}
+	}
+
+	for id := range merged {
+		delete(books, id)
+	}
+	books[survivor] = book
+	saveBooks()
+	saveVisitors()
+	// The copies of the duplicates become copies of the survivor
+	movedCopies := false
+	for barcode, item := range items {
+		if merged[item.BookID] {
+			item.BookID = survivor
+			items[barcode] = item
+			movedCopies = true
+		}
+	}
+	if movedCopies {
+		saveItems()
+	}
+	if len(holds) > 0 {
+		rewriteHolds(func(h *Hold) {
+			if merged[h.BookID] {
+				h.BookID = survivor
+			}
+		})
+	}
+	return nil
+}
+
+// mergeVisitors folds the visitors in others into survivor, who takes over all their rentals.
+func mergeVisitors(survivor int, others []int) error {
+	visitor, exists := visitors[survivor]
+	if !exists {
+		return errors.New("visitor not found")
+	}
+	for _, id := range others {
+		if _, exists := visitors[id]; !exists {
+			return fmt.Errorf("visitor %d not found", id)
+		}
+	}
+	if err := visitorMergeConflict(appendUnique(append([]int{}, others...), survivor)); err != nil {
+		return err
+	}
+	for _, id := range others {
+		if id == survivor {
+			continue
+		}
+		for _, bid := range visitors[id].RentedIDs {
+			visitor.RentedIDs = appendUnique(visitor.RentedIDs, bid)
+		}
+		for _, loan := range visitors[id].Loans {
+			if findLoan(visitor, loan.BookID) == -1 {
+				visitor.Loans = append(visitor.Loans, loan)
+			}
+		}
+		other := visitors[id]
+		if visitor.Card == "" { // Keep a card that was handed out; the others stop working
+			visitor.Card = other.Card
+		}
+		for _, field := range []string{"email", "phone", "address", "notes"} {
+			if getVisitorField(visitor, field) == "" {
+				setVisitorField(&visitor, field, getVisitorField(other, field))
+			}
+		}
+		// The merged membership runs from the first join to the last expiry
+		if !other.Joined.IsZero() && (visitor.Joined.IsZero() || other.Joined.Before(visitor.Joined)) {
+			visitor.Joined = other.Joined
+		}
+		if !visitor.Expires.IsZero() && (other.Expires.IsZero() || other.Expires.After(visitor.Expires)) {
+			visitor.Expires = other.Expires
+		}
+		delete(visitors, id)
+	}
+	visitors[survivor] = visitor
+	saveVisitors()
+	// Fines and payments of the duplicates move to the survivor's account
+	moved := false
+	for i, entry := range ledger {
+		for _, id := range others {
+			if entry.VisitorID == id && id != survivor {
+				ledger[i].VisitorID = survivor
+				moved = true
+			}
+		}
+	}
+	if moved {
+		saveLedger()
+	}
+	if len(holds) > 0 {
+		rewriteHolds(func(h *Hold) {
+			for _, id := range others {
+				if h.VisitorID == id {
+					h.VisitorID = survivor
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// pickSurvivor asks which ID of cluster to keep. It returns 0 when the user skips the cluster.
+func pickSurvivor(p *prompter, cluster []int) (int, error) {
+	for {
+		text, err := p.line("Keep which ID? (Enter to skip): ")
+		if err != nil || text == "" || text == "skip" {
+			return 0, err
+		}
+		id, err := strconv.Atoi(text)
+		if err == nil {
+			for _, member := range cluster {
+				if member == id {
+					return id, nil
+				}
+			}
+		}
+		p.retry("Please enter one of the IDs above")
+	}
+}
+
+// handleDedupe walks through the groups of likely duplicates and merges the
+// ones the user picks a survivor for.
+func handleDedupe(p *prompter) error {
+	what, err := p.choice("Find duplicate books or visitors? ", []string{"books", "visitors"})
+	if err != nil {
+		return err
+	}
+
+	clusters := bookClusters()
+	if what == "visitors" {
+		clusters = visitorClusters()
+	}
+	if len(clusters) == 0 {
+		fmt.Println("No likely duplicates found.")
+		return nil
+	}
+	fmt.Printf("Found %d group(s) of likely duplicates.\n", len(clusters))
+
+	mergedCount := 0
+	for i, cluster := range clusters {
+		fmt.Printf("\nGroup %d of %d:\n", i+1, len(clusters))
+		for _, id := range cluster {
+			if what == "books" {
+				book := books[id]
+				fmt.Printf("  ID: %d, Title: %s, Author: %s, ISBN: %s, Year: %s, Rented by: %d\n",
+					book.ID, book.Title, book.Author, orNone(book.ISBN), orNone(getBookField(book, "year")), renterCount(id))
+			} else {
+				v := visitors[id]
+				fmt.Printf("  ID: %d, Name: %s, Renting: %d book(s)\n", v.ID, v.Name, len(v.RentedIDs))
+			}
+		}
+
+		conflict := bookMergeConflict(cluster)
+		if what == "visitors" {
+			conflict = visitorMergeConflict(cluster)
+		}
+		if conflict != nil {
+			fmt.Printf("Can't merge this group: %v.\n", conflict)
+			continue
+		}
+
+		survivor, err := pickSurvivor(p, cluster)
+		if err != nil {
+			return err
+		}
+		if survivor == 0 {
+			fmt.Println("Skipped.")
+			continue
+		}
+		// Not p.confirm: "n" only skips this group, "cancel" still stops the whole command
+		if !assumeYes {
+			yes, err := p.yesNo(fmt.Sprintf("Merge %d %s into ID %d? (y/n): ", len(cluster)-1, what, survivor))
+			if err != nil {
+				return err
+			}
+			if !yes {
+				fmt.Println("Skipped.")
+				continue
+			}
+		}
+
+		if what == "books" {
+			err = mergeBooks(survivor, cluster)
+		} else {
+			err = mergeVisitors(survivor, cluster)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Merged into ID %d.\n", survivor)
+		mergedCount++
+	}
+	fmt.Printf("\n%d group(s) merged.\n", mergedCount)
+	return nil
+}
+
+// renterCount returns how many visitors are renting book id.
+func renterCount(id int) int {
+	count := 0
+	for _, v := range visitors {
+		for _, bid := range v.RentedIDs {
+			if bid == id {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exportTable is a generic table of text cells that every export format can render.
+type exportTable struct {
+	Title   string     // Title is shown as the heading in Markdown and HTML
+	Headers []string   // Headers are the column names
+	Rows    [][]string // Rows holds one slice of cells per record
+}
+
+// exportFormats lists the formats EXPORT understands.
+var exportFormats = []string{"csv", "json", "md", "html"}
+
+// matchesQuery reports whether text contains query, ignoring case.
+// An empty query matches everything. SEARCH and EXPORT share this rule.
+func matchesQuery(text, query string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(query))
+}
+
+// sortedBookIDs returns the book IDs in ascending order so output is stable.
+func sortedBookIDs() []int {
+	ids := make([]int, 0, len(books))
+	for id := range books {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// sortedVisitorIDs returns the visitor IDs in ascending order so output is stable.
+func sortedVisitorIDs() []int {
+	ids := make([]int, 0, len(visitors))
+	for id := range visitors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// bookTitle returns the title of the book with the given ID, or a marker if it is missing.
+func bookTitle(id int) string {
+	if book, exists := books[id]; exists {
+		return book.Title
+	}
+	return fmt.Sprintf("(unknown book %d)", id)
+}
+
+// booksTable builds the catalog table, keeping books whose title matches query.
+func booksTable(query string) exportTable {
+	table := exportTable{Title: "Books", Headers: []string{"ID", "Title", "Author", "ISBN", "Publisher", "Year"}}
+	for _, id := range sortedBookIDs() {
+		book := books[id]
+		if !matchesQuery(book.Title, query) {
+			continue
+		}
+		year := ""
+		if book.Year != 0 {
+			year = strconv.Itoa(book.Year)
+		}
+		table.Rows = append(table.Rows, []string{strconv.Itoa(book.ID), book.Title, book.Author, book.ISBN, book.Publisher, year})
+	}
+	return table
+}
+
+// visitorsTable builds the visitor roster with rented titles resolved, keeping visitors whose name matches query.
+func visitorsTable(query string) exportTable {
+	table := exportTable{Title: "Visitors", Headers: []string{"ID", "Name", "Rented Books"}}
+	for _, id := range sortedVisitorIDs() {
+		v := visitors[id]
+		if !matchesQuery(v.Name, query) {
+			continue
+		}
+		titles := []string{}
+		for _, bid := range v.RentedIDs {
+			titles = append(titles, bookTitle(bid))
+		}
+		table.Rows = append(table.Rows, []string{strconv.Itoa(v.ID), v.Name, strings.Join(titles, "; ")})
+	}
+	return table
+}
+
+// loansTable lists every rented book with its dates, keeping loans whose book
+// title matches query. Loans from before dates were kept have none.
+func loansTable(query string) exportTable {
+	table := exportTable{Title: "Loans", Headers: []string{"Visitor ID", "Visitor", "Book ID", "Title", "Rented", "Due"}}
+	for _, id := range sortedVisitorIDs() {
+		v := visitors[id]
+		for _, bid := range v.RentedIDs {
+			title := bookTitle(bid)
+			if !matchesQuery(title, query) {
+				continue
+			}
+			var loan Loan
+			if i := findLoan(v, bid); i != -1 {
+				loan = v.Loans[i]
+			}
+			table.Rows = append(table.Rows, []string{strconv.Itoa(v.ID), v.Name, strconv.Itoa(bid), title, formatDate(loan.Rented), formatDate(loan.Due)})
+		}
+	}
+	return table
+}
+
+func writeCSV(w io.Writer, table exportTable) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Headers); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(table.Rows); err != nil { // WriteAll also flushes
+		return err
+	}
+	return writer.Error()
+}
+
+// writeJSON writes the table as a pretty-printed array of objects keyed by header.
+func writeJSON(w io.Writer, table exportTable) error {
+	records := make([]map[string]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		record := make(map[string]string)
+		for i, header := range table.Headers {
+			record[header] = row[i]
+		}
+		records = append(records, record)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// markdownCell escapes characters that would break a Markdown table.
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
+
+func writeMarkdown(w io.Writer, table exportTable) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", table.Title)
+	fmt.Fprintf(&b, "| %s |\n", strings.Join(table.Headers, " | "))
+	fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(table.Headers)))
+	for _, row := range table.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = markdownCell(cell)
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHTML writes a standalone HTML page that can be opened or printed directly.
+func writeHTML(w io.Writer, table exportTable) error {
+	var b strings.Builder
+	title := html.EscapeString(table.Title)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{border:1px solid #999;padding:4px 8px;text-align:left}th{background:#eee}</style>\n")
+	b.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p>%d record(s)</p>\n<table>\n<tr>", title, len(table.Rows))
+	for _, header := range table.Headers {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(header))
+	}
+	b.WriteString("</tr>\n")
+	for _, row := range table.Rows {
+		b.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(cell))
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeExport renders table to w in the given format.
+func writeExport(w io.Writer, table exportTable, format string) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, table)
+	case "json":
+		return writeJSON(w, table)
+	case "md":
+		return writeMarkdown(w, table)
+	case "html":
+		return writeHTML(w, table)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(exportFormats, ", "))
+	}
+}
+
+// buildExportTable returns the table for what (books, visitors or loans).
+func buildExportTable(what, query string) (exportTable, error) {
+	switch what {
+	case "books":
+		return booksTable(query), nil
+	case "visitors":
+		return visitorsTable(query), nil
+	case "loans":
+		return loansTable(query), nil
+	default:
+		return exportTable{}, fmt.Errorf("unknown export %q, expected books, visitors or loans", what)
+	}
+}
+
+// exportData writes the requested table to path, or to stdout when path is empty.
+func exportData(what, format, query, path string) error {
+	table, err := buildExportTable(what, query)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return writeExport(os.Stdout, table, format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeExport(file, table, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d record(s) to %s\n", len(table.Rows), path)
+	return nil
+}
+
+func handleExport(p *prompter) error {
+	what, err := p.choice("Export what? (books/visitors/loans): ", []string{"books", "visitors", "loans"})
+	if err != nil {
+		return err
+	}
+
+	format, err := p.choice(fmt.Sprintf("Format (%s): ", strings.Join(exportFormats, "/")), exportFormats)
+	if err != nil {
+		return err
+	}
+
+	query, err := p.line("Filter keyword (Enter for all): ")
+	if err != nil {
+		return err
+	}
+
+	path, err := p.line("Output file (Enter to print here): ")
+	if err != nil {
+		return err
+	}
+
+	if err := exportData(what, format, query, path); err != nil {
+		return fmt.Errorf("exporting: %w", err)
+	}
+	p.waitForReturn()
+	return nil
+}
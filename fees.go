@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeeRules are the late fee settings. Amounts are in cents.
+type FeeRules struct {
+	Currency       string `json:"currency"`        // Currency is printed before amounts
+	DailyRate      int    `json:"daily_rate"`      // DailyRate is charged for every day a book is late
+	GraceDays      int    `json:"grace_days"`      // GraceDays are late days that are not charged
+	MaxPerLoan     int    `json:"max_per_loan"`    // MaxPerLoan caps the fine for one loan, 0 for no cap
+	BlockThreshold int    `json:"block_threshold"` // BlockThreshold is the balance above which renting is refused
+}
+
+var feesFile = "fees.json"     // feesFile overrides the default fee rules
+var ledgerFile = "ledger.json" // ledgerFile is the name of the file where account entries are stored
+
+// feeRules start with these defaults; fees.json replaces the fields it sets.
+var feeRules = FeeRules{Currency: "$", DailyRate: 25, GraceDays: 0, MaxPerLoan: 1000, BlockThreshold: 500}
+
+// LedgerEntry is one charge or credit on a visitor's account.
+// Fines are positive, payments and waivers negative.
+type LedgerEntry struct {
+	VisitorID int       `json:"visitor_id"`
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`              // Kind is "fine", "payment" or "waiver"
+	Amount    int       `json:"amount"`            // Amount is in cents
+	BookID    int       `json:"book_id,omitempty"` // BookID is the late book, for fines
+	Note      string    `json:"note,omitempty"`
+}
+
+var ledger []LedgerEntry // ledger holds every account entry, oldest first
+
+func loadFeeRules() {
+	data, err := os.ReadFile(feesFile)
+	if err != nil {
+		return // The default rules apply
+	}
+	rules := feeRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		fmt.Println("Error reading fee rules, using the defaults:", err)
+		return
+	}
+	if rules.DailyRate < 0 || rules.GraceDays < 0 || rules.MaxPerLoan < 0 || rules.BlockThreshold < 0 {
+		fmt.Println("Error reading fee rules, using the defaults: amounts must not be negative")
+		return
+	}
+	feeRules = rules
+}
+
+func loadLedger() {
+	data, err := os.ReadFile(ledgerFile)
+	if err != nil {
+		return // No fines charged yet
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		fmt.Println("Error reading ledger:", err)
+	}
+}
+
+func saveLedger() {
+	if dryRunMode {
+		fmt.Println("(dry run) ledger not saved")
+		return
+	}
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving ledger:", err)
+		return
+	}
+	if err := os.WriteFile(ledgerFile, data, 0644); err != nil {
+		fmt.Println("Error writing ledger file:", err)
+	}
+}
+
+// formatMoney prints cents as e.g. "$2.50".
+func formatMoney(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%s%d.%02d", sign, feeRules.Currency, cents/100, cents%100)
+}
+
+// maxAmount is the largest amount parseMoney accepts, in cents. It keeps
+// typos like "1e300" from overflowing the ledger.
+const maxAmount = 1000000 * 100
+
+// parseMoney reads an amount such as "2.5", "2.50" or "$2" as cents.
+func parseMoney(text string) (int, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), feeRules.Currency)
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%q is not an amount", text)
+	}
+	if value <= 0 || value*100 > maxAmount {
+		return 0, fmt.Errorf("the amount must be more than 0 and at most %s", formatMoney(maxAmount))
+	}
+	cents := int(math.Round(value * 100))
+	if cents == 0 {
+		return 0, fmt.Errorf("the amount must be at least %s", formatMoney(1))
+	}
+	return cents, nil
+}
+
+// balance returns what visitor vid owes, in cents.
+func balance(vid int) int {
+	total := 0
+	for _, entry := range ledger {
+		if entry.VisitorID == vid {
+			total += entry.Amount
+		}
+	}
+	return total
+}
+
+// lateFine returns the fine for a loan returned at returned.
+func lateFine(loan Loan, returned time.Time) int {
+	if loan.Due.IsZero() || !returned.After(loan.Due) {
+		return 0
+	}
+	// Every started day counts as a late day
+	days := int(math.Ceil(returned.Sub(loan.Due).Hours()/24)) - feeRules.GraceDays
+	if days <= 0 {
+		return 0
+	}
+	fine := days * feeRules.DailyRate
+	if feeRules.MaxPerLoan > 0 && fine > feeRules.MaxPerLoan {
+		fine = feeRules.MaxPerLoan
+	}
+	return fine
+}
+
+// chargeLateFine adds the fine for loan, if it is late, to visitor vid's account.
+func chargeLateFine(vid int, loan Loan) int {
+	now := clock.Now()
+	fine := lateFine(loan, now)
+	if fine == 0 {
+		return 0
+	}
+	ledger = append(ledger, LedgerEntry{
+		VisitorID: vid,
+		Time:      now,
+		Kind:      "fine",
+		Amount:    fine,
+		BookID:    loan.BookID,
+		Note:      "returned late, due " + loan.Due.Format("2006-01-02"),
+	})
+	saveLedger()
+	return fine
+}
+
+// checkBalance returns an error when v owes more than renting allows.
+func checkBalance(v Visitor) error {
+	if owed := balance(v.ID); owed > feeRules.BlockThreshold {
+		return fmt.Errorf("%s owes %s, more than the %s allowed; use PAY first", v.Name, formatMoney(owed), formatMoney(feeRules.BlockThreshold))
+	}
+	return nil
+}
+
+// credit records a payment or waiver of amount cents for visitor vid.
+func credit(vid int, kind string, amount int, note string) error {
+	if _, exists := visitors[vid]; !exists {
+		return errors.New("visitor not found")
+	}
+	owed := balance(vid)
+	if owed <= 0 {
+		return errors.New("visitor doesn't owe anything")
+	}
+	if amount > owed {
+		return fmt.Errorf("%s is more than the %s owed", formatMoney(amount), formatMoney(owed))
+	}
+	ledger = append(ledger, LedgerEntry{VisitorID: vid, Time: clock.Now(), Kind: kind, Amount: -amount, Note: note})
+	saveLedger()
+	return nil
+}
+
+func handlePay(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	if _, exists := visitors[vid]; !exists {
+		return errors.New("visitor not found")
+	}
+	fmt.Println("Balance:", formatMoney(balance(vid)))
+	amount, err := askAmount(p, "Amount paid (or ALL): ", vid)
+	if err != nil {
+		return err
+	}
+	if err := credit(vid, "payment", amount, ""); err != nil {
+		return fmt.Errorf("could not record payment: %w", err)
+	}
+	fmt.Printf("Payment of %s recorded, balance now %s.\n", formatMoney(amount), formatMoney(balance(vid)))
+	return nil
+}
+
+func handleWaive(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	if _, exists := visitors[vid]; !exists {
+		return errors.New("visitor not found")
+	}
+	fmt.Println("Balance:", formatMoney(balance(vid)))
+	amount, err := askAmount(p, "Amount to waive (or ALL): ", vid)
+	if err != nil {
+		return err
+	}
+	reason, err := p.text("Reason: ")
+	if err != nil {
+		return err
+	}
+	if err := credit(vid, "waiver", amount, reason); err != nil {
+		return fmt.Errorf("could not waive: %w", err)
+	}
+	fmt.Printf("Waived %s, balance now %s.\n", formatMoney(amount), formatMoney(balance(vid)))
+	return nil
+}
+
+// askAmount asks until the answer is an amount. ALL means the whole balance of visitor vid.
+func askAmount(p *prompter, label string, vid int) (int, error) {
+	for {
+		text, err := p.line(label)
+		if err != nil {
+			return 0, err
+		}
+		if strings.EqualFold(text, "all") {
+			return balance(vid), nil
+		}
+		amount, err := parseMoney(text)
+		if err == nil {
+			return amount, nil
+		}
+		p.retry("%v", err)
+	}
+}
+
+// handleAccount lists the entries on a visitor's account.
+func handleAccount(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	v, exists := visitors[vid]
+	if !exists {
+		return errors.New("visitor not found")
+	}
+	fmt.Printf("Account of %s\n", v.Name)
+	found := false
+	for _, entry := range ledger {
+		if entry.VisitorID != vid {
+			continue
+		}
+		found = true
+		details := []string{}
+		if entry.BookID != 0 {
+			details = append(details, bookTitle(entry.BookID))
+		}
+		if entry.Note != "" {
+			details = append(details, entry.Note)
+		}
+		detail := strings.Join(details, ", ")
+		line := fmt.Sprintf("  %s  %-8s %9s  %s", entry.Time.Format("2006-01-02"), entry.Kind, formatMoney(entry.Amount), detail)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	if !found {
+		fmt.Println("  No entries.")
+	}
+	fmt.Println("Balance:", formatMoney(balance(vid)))
+	p.waitForReturn()
+	return nil
+}
@@ -1,3 +1,10 @@
 module go-crud
 
 go 1.24.3
+
+require (
+	golang.org/x/term v0.34.0
+	golang.org/x/text v0.28.0
+)
+
+require golang.org/x/sys v0.35.0 // indirect
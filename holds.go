@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Hold is a visitor's place in the queue for a book whose copies are all out.
+// Holds for one book are served in the order they were placed.
+type Hold struct {
+	BookID    int       `json:"book_id"`            // BookID is the book being waited for
+	VisitorID int       `json:"visitor_id"`         // VisitorID is the visitor waiting
+	Placed    time.Time `json:"placed"`             // Placed is when the hold was made
+	PickupBy  time.Time `json:"pickup_by,omitzero"` // PickupBy is set once the book is back and kept for this visitor
+}
+
+var holds []Hold             // holds are all holds, oldest first
+var holdsFile = "holds.json" // holdsFile is the name of the file where holds are stored
+const holdPickupDays = 7     // holdPickupDays is how long a returned book is kept for the next holder
+
+// ready reports whether the book is back and waiting for this hold's visitor.
+func (h Hold) ready() bool {
+	return !h.PickupBy.IsZero()
+}
+
+func loadHolds() {
+	data, err := os.ReadFile(holdsFile)
+	if err != nil {
+		return // No holds placed yet
+	}
+	if err := json.Unmarshal(data, &holds); err != nil {
+		fmt.Println("Error reading holds:", err)
+	}
+}
+
+func saveHolds() {
+	if dryRunMode {
+		fmt.Println("(dry run) holds not saved")
+		return
+	}
+	data, err := json.MarshalIndent(holds, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving holds:", err)
+		return
+	}
+	if err := os.WriteFile(holdsFile, data, 0644); err != nil {
+		fmt.Println("Error writing holds file:", err)
+	}
+}
+
+// bookRenter returns the ID of a visitor renting book bid, or 0 if nobody is.
+// It is how a book without registered copies is known to be out.
+func bookRenter(bid int) int {
+	for _, id := range sortedVisitorIDs() {
+		for _, rid := range visitors[id].RentedIDs {
+			if rid == bid {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// holdQueue returns the holds for book bid, first in line first.
+func holdQueue(bid int) []Hold {
+	queue := []Hold{}
+	for _, h := range holds {
+		if h.BookID == bid {
+			queue = append(queue, h)
+		}
+	}
+	return queue
+}
+
+// removeHolds drops every hold for which drop returns true and reports whether any went.
+func removeHolds(drop func(Hold) bool) bool {
+	kept := holds[:0]
+	for _, h := range holds {
+		if !drop(h) {
+			kept = append(kept, h)
+		}
+	}
+	removed := len(kept) != len(holds)
+	holds = kept
+	return removed
+}
+
+// rewriteHolds applies rewrite to every hold, e.g. to move holds to a merged
+// book, then drops holds that became repeats of an earlier one and saves.
+func rewriteHolds(rewrite func(h *Hold)) {
+	seen := make(map[[2]int]bool)
+	kept := []Hold{}
+	for _, h := range holds {
+		rewrite(&h)
+		key := [2]int{h.BookID, h.VisitorID}
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, h)
+		}
+	}
+	holds = kept
+	saveHolds()
+}
+
+// isRenting reports whether visitor vid has a copy of book bid.
+func isRenting(vid, bid int) bool {
+	for _, rid := range visitors[vid].RentedIDs {
+		if rid == bid {
+			return true
+		}
+	}
+	return false
+}
+
+// readyHolds returns the holds on book bid with a copy kept for them.
+func readyHolds(bid int) []Hold {
+	ready := []Hold{}
+	for _, h := range holdQueue(bid) {
+		if h.ready() {
+			ready = append(ready, h)
+		}
+	}
+	return ready
+}
+
+// placeHold puts visitor vid at the end of the queue for book bid and
+// returns their position in it.
+func placeHold(vid, bid int) (int, error) {
+	if _, exists := visitors[vid]; !exists {
+		return 0, errors.New("visitor not found")
+	}
+	if _, exists := books[bid]; !exists {
+		return 0, errors.New("book not found")
+	}
+	if isRenting(vid, bid) {
+		return 0, errors.New("visitor is already renting this book")
+	}
+	queue := holdQueue(bid)
+	for _, h := range queue {
+		if h.VisitorID == vid {
+			return 0, errors.New("visitor already has a hold on this book")
+		}
+	}
+	if availableCopies(bid) > len(readyHolds(bid)) {
+		return 0, errors.New("a copy is available, rent it instead")
+	}
+	holds = append(holds, Hold{BookID: bid, VisitorID: vid, Placed: clock.Now()})
+	saveHolds()
+	return len(queue) + 1, nil
+}
+
+// checkHoldsForRent returns an error when every available copy of book bid
+// is kept for other visitors, or when there is none and others are waiting.
+func checkHoldsForRent(vid, bid int) error {
+	ready := readyHolds(bid)
+	for _, h := range ready {
+		if h.VisitorID == vid {
+			return nil // A copy is kept for them
+		}
+	}
+	available := availableCopies(bid)
+	if available > len(ready) {
+		return nil
+	}
+	if available > 0 {
+		first := ready[0]
+		return fmt.Errorf("the available copies are held, e.g. for %s until %s", visitors[first.VisitorID].Name, first.PickupBy.Format("2006-01-02"))
+	}
+	if renter := bookRenter(bid); len(bookItems(bid)) == 0 && renter != 0 {
+		return fmt.Errorf("book is rented by %s, use HOLD to join the queue", visitors[renter].Name)
+	}
+	return errors.New("no copy is available, use HOLD to join the queue")
+}
+
+// fulfillHold removes visitor vid's hold on book bid once they rent it.
+func fulfillHold(vid, bid int) {
+	if removeHolds(func(h Hold) bool { return h.BookID == bid && h.VisitorID == vid }) {
+		saveHolds()
+	}
+}
+
+// promoteHolds keeps each available copy of book bid that isn't kept yet for
+// the next visitor waiting, and returns the holds that became ready.
+func promoteHolds(bid int) []Hold {
+	spare := availableCopies(bid) - len(readyHolds(bid))
+	promoted := []Hold{}
+	for i, h := range holds {
+		if spare <= 0 {
+			break
+		}
+		if h.BookID != bid || h.ready() {
+			continue
+		}
+		holds[i].PickupBy = clock.Now().AddDate(0, 0, holdPickupDays)
+		promoted = append(promoted, holds[i])
+		spare--
+	}
+	if len(promoted) > 0 {
+		saveHolds()
+	}
+	return promoted
+}
+
+// expireHolds drops holds whose pickup deadline has passed and passes those
+// copies on to the next visitor in line.
+func expireHolds() {
+	now := clock.Now()
+	expired := []int{}
+	removeHolds(func(h Hold) bool {
+		if h.ready() && now.After(h.PickupBy) {
+			expired = append(expired, h.BookID)
+			return true
+		}
+		return false
+	})
+	if len(expired) == 0 {
+		return
+	}
+	saveHolds()
+	for _, bid := range expired {
+		promoteHolds(bid)
+	}
+}
+
+// holdStatus describes a hold for listings.
+func holdStatus(h Hold, position int) string {
+	if h.ready() {
+		return "ready, pick up by " + h.PickupBy.Format("2006-01-02")
+	}
+	return fmt.Sprintf("waiting, #%d in line", position)
+}
+
+func handleHold(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	bid, err := p.bookID("Book ID to hold: ")
+	if err != nil {
+		return err
+	}
+	expireHolds()
+	position, err := placeHold(vid, bid)
+	if err != nil {
+		return fmt.Errorf("could not place hold: %w", err)
+	}
+	fmt.Printf("Hold placed for %s, #%d in line for %q.\n", visitors[vid].Name, position, books[bid].Title)
+	return nil
+}
+
+// showHolds lists the queue of every held book, then the holds of every visitor.
+func showHolds(p *prompter) error {
+	expireHolds()
+	if len(holds) == 0 {
+		fmt.Println("No holds.")
+		p.waitForReturn()
+		return nil
+	}
+
+	fmt.Println("By book:")
+	for _, bid := range sortedBookIDs() {
+		queue := holdQueue(bid)
+		if len(queue) == 0 {
+			continue
+		}
+		fmt.Printf("ID: %d, Title: %s\n", bid, books[bid].Title)
+		for i, h := range queue {
+			fmt.Printf("  %d. %s (%s)\n", i+1, visitors[h.VisitorID].Name, holdStatus(h, i+1))
+		}
+	}
+
+	fmt.Println("\nBy visitor:")
+	for _, vid := range sortedVisitorIDs() {
+		first := true
+		for _, h := range holds {
+			if h.VisitorID != vid {
+				continue
+			}
+			if first {
+				fmt.Printf("ID: %d, Name: %s\n", vid, visitors[vid].Name)
+				first = false
+			}
+			position := 1
+			for _, other := range holdQueue(h.BookID) {
+				if other.VisitorID == vid {
+					break
+				}
+				position++
+			}
+			fmt.Printf("  %s (%s)\n", books[h.BookID].Title, holdStatus(h, position))
+		}
+	}
+	p.waitForReturn()
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// importRow is a single book read from an import file, before it is validated.
+type importRow struct {
+	Line      int    // Line is the row number in the source file, used in error messages
+	Title     string // Title is the title read from the file
+	Author    string // Author is the author read from the file
+	ISBN      string // ISBN is optional
+	Publisher string // Publisher is optional
+	Year      string // Year is optional and kept as text until validation
+	Problem   string // Problem is set when the row could not be read at all, e.g. a stray quote
+}
+
+// importReport collects what happened during an import so it can be printed at the end.
+type importReport struct {
+	Added   int      // Added is how many books were (or would be) created
+	Skipped int      // Skipped is how many rows were rejected
+	Errors  []string // Errors holds one message per rejected row
+}
+
+// headerAliases maps the column names we recognise in a CSV header to book fields.
+var headerAliases = map[string]string{
+	"title":      "title",
+	"book":       "title",
+	"book title": "title",
+	"name":       "title",
+	"author":     "author",
+	"authors":    "author",
+	"writer":     "author",
+	"by":         "author",
+	"isbn":       "isbn",
+	"publisher":  "publisher",
+	"year":       "year",
+}
+
+// importFields lists the book fields an import can fill; only title and author are required.
+var importFields = []string{"title", "author", "isbn", "publisher", "year"}
+
+// parseHeaderMapping turns user input like "title=Book Name, author=Writer"
+// into a map from book field to CSV column name.
+func parseHeaderMapping(input string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return mapping, nil
+	}
+	for _, part := range strings.Split(input, ",") {
+		field, column, ok := strings.Cut(part, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected field=column", strings.TrimSpace(part))
+		}
+		if !slices.Contains(importFields, field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(importFields, ", "))
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// readCSVRows reads books from a CSV file. The first line must be a header;
+// mapping overrides which header column is used for each field.
+func readCSVRows(r io.Reader, mapping map[string]string) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Rows with missing columns are reported per row instead of failing the whole file
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for _, field := range importFields {
+		columns[field] = -1
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for field, column := range mapping {
+			if strings.ToLower(column) == name {
+				columns[field] = i
+			}
+		}
+		if field, ok := headerAliases[name]; ok && mapping[field] == "" && columns[field] == -1 {
+			columns[field] = i
+		}
+	}
+	for _, field := range []string{"title", "author"} {
+		if columns[field] == -1 {
+			return nil, fmt.Errorf("CSV header has no column for %s", field)
+		}
+	}
+
+	rows := []importRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// A broken row is reported like any other bad row; the reader carries on after it
+			rows = append(rows, importRow{Line: parseErr.StartLine, Problem: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{Line: line}
+		for field, i := range columns {
+			if i >= 0 && i < len(record) {
+				row.set(field, record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readJSONRows reads books from a JSON array of objects with "title" and "author" keys.
+func readJSONRows(r io.Reader) ([]importRow, error) {
+	var entries []map[string]any
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("reading JSON array: %w", err)
+	}
+
+	rows := []importRow{}
+	for i, entry := range entries {
+		row := importRow{Line: i + 1}
+		for key, value := range entry {
+			field, ok := headerAliases[strings.ToLower(key)]
+			if !ok {
+				continue
+			}
+			switch value := value.(type) {
+			case string:
+				row.set(field, value)
+			case float64: // JSON numbers, e.g. "year": 1965
+				row.set(field, strconv.FormatFloat(value, 'f', -1, 64))
+			} // Other values are left empty and rejected by validation if required
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// set stores value in the row field named field.
+func (row *importRow) set(field, value string) {
+	switch field {
+	case "title":
+		row.Title = value
+	case "author":
+		row.Author = value
+	case "isbn":
+		row.ISBN = value
+	case "publisher":
+		row.Publisher = value
+	case "year":
+		row.Year = value
+	}
+}
+
+// importBooks validates rows and adds the good ones to the catalog.
+// When dryRun is true nothing is added or saved, but the report is the same.
+func importBooks(rows []importRow, dryRun bool) importReport {
+	report := importReport{}
+
+	seen := make(map[string]int) // seen maps a book key to the ID (or import line) that already has it
+	for _, book := range books {
+		seen[bookKey(book.Title, book.Author)] = book.ID
+	}
+
+	for _, row := range rows {
+		year, yearErr := 0, error(nil)
+		if text := strings.TrimSpace(row.Year); text != "" {
+			year, yearErr = strconv.Atoi(text)
+		}
+		book, err := validateBook(Book{Title: row.Title, Author: row.Author, ISBN: row.ISBN, Publisher: row.Publisher, Year: year})
+
+		var problem string
+		switch {
+		case row.Problem != "":
+			problem = row.Problem
+		case strings.TrimSpace(row.Title) == "":
+			problem = "missing title"
+		case strings.TrimSpace(row.Author) == "":
+			problem = "missing author"
+		case yearErr != nil:
+			problem = fmt.Sprintf("invalid year %q", strings.TrimSpace(row.Year))
+		case err != nil:
+			problem = err.Error()
+		}
+		if problem == "" {
+			if id, exists := seen[bookKey(book.Title, book.Author)]; exists {
+				if id > 0 {
+					problem = fmt.Sprintf("duplicate of book ID %d", id)
+				} else {
+					problem = fmt.Sprintf("duplicate of row %d", -id)
+				}
+			}
+		}
+		if problem != "" {
+			report.Skipped++
+			report.Errors = append(report.Errors, fmt.Sprintf("row %d: %s", row.Line, problem))
+			continue
+		}
+
+		report.Added++
+		if dryRun {
+			seen[bookKey(book.Title, book.Author)] = -row.Line // Negative values mark rows from this file
+			continue
+		}
+		book.ID = nextID
+		books[nextID] = book
+		seen[bookKey(book.Title, book.Author)] = nextID
+		nextID++
+	}
+
+	if !dryRun && report.Added > 0 {
+		saveBooks()
+	}
+	return report
+}
+
+// loadImportFile reads rows from path, picking the format from the file extension.
+func loadImportFile(path, mappingInput string) ([]importRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		mapping, err := parseHeaderMapping(mappingInput)
+		if err != nil {
+			return nil, err
+		}
+		return readCSVRows(file, mapping)
+	case ".json":
+		return readJSONRows(file)
+	default:
+		return nil, fmt.Errorf("unsupported file type %q, use .csv or .json", filepath.Ext(path))
+	}
+}
+
+func printImportReport(report importReport, dryRun bool) {
+	if dryRun {
+		fmt.Println("Dry run, nothing was saved.")
+		fmt.Printf("Would add %d book(s), skip %d row(s).\n", report.Added, report.Skipped)
+	} else {
+		fmt.Printf("Added %d book(s), skipped %d row(s).\n", report.Added, report.Skipped)
+	}
+	for _, msg := range report.Errors {
+		fmt.Println("  " + msg)
+	}
+}
+
+func handleImport(p *prompter) error {
+	path, err := p.text("Enter file to import (.csv or .json): ")
+	if err != nil {
+		return err
+	}
+
+	mappingInput := ""
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		mappingInput, err = p.line("Column mapping (e.g. title=Book Name, author=Writer), Enter for auto: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	dryRun, err := p.yesNo("Dry run? (y/n): ")
+	if err != nil {
+		return err
+	}
+
+	rows, err := loadImportFile(path, mappingInput)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", path, err)
+	}
+	printImportReport(importBooks(rows, dryRun), dryRun)
+	p.waitForReturn()
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var isbnDataFile = "isbn_metadata.jsonl" // isbnDataFile is the local metadata dump used to look up ISBNs
+
+// isbnMetadata is what we know about a book from the metadata dump.
+type isbnMetadata struct {
+	ISBN      string
+	Title     string
+	Author    string
+	Publisher string
+	Year      int
+}
+
+// isbnRecord is one line of the dump. It accepts both a simple flat layout
+// ({"isbn": ..., "title": ..., "author": ...}) and the field names used by
+// Open Library edition records and search results.
+type isbnRecord struct {
+	ISBN        string          `json:"isbn"`
+	ISBN10      []string        `json:"isbn_10"`
+	ISBN13      []string        `json:"isbn_13"`
+	Title       string          `json:"title"`
+	Subtitle    string          `json:"subtitle"`
+	Author      string          `json:"author"`
+	AuthorName  []string        `json:"author_name"`
+	ByStatement string          `json:"by_statement"`
+	Publisher   string          `json:"publisher"`
+	Publishers  []string        `json:"publishers"`
+	Year        json.RawMessage `json:"year"`
+	PublishDate string          `json:"publish_date"`
+}
+
+var isbnIndex map[string]isbnMetadata // isbnIndex maps a normalized ISBN-13 to its metadata, loaded on first use
+
+// cleanISBN strips hyphens and spaces and upper-cases a trailing X.
+func cleanISBN(isbn string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(isbn) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validISBN reports whether isbn (already cleaned) is a valid ISBN-10 or ISBN-13.
+func validISBN(isbn string) bool {
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			digit := int(r - '0')
+			if r == 'X' {
+				if i != 9 {
+					return false
+				}
+				digit = 10
+			}
+			sum += (10 - i) * digit
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range isbn {
+			if r == 'X' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(r-'0')
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+// isbn13 converts a valid cleaned ISBN-10 to ISBN-13 so both forms share one index key.
+func isbn13(isbn string) string {
+	if len(isbn) != 10 {
+		return isbn
+	}
+	core := "978" + isbn[:9]
+	sum := 0
+	for i, r := range core {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(r-'0')
+	}
+	return core + strconv.Itoa((10-sum%10)%10)
+}
+
+// normalizeISBN cleans and validates isbn and returns its ISBN-13 form.
+func normalizeISBN(isbn string) (string, error) {
+	clean := cleanISBN(isbn)
+	if !validISBN(clean) {
+		return "", fmt.Errorf("%q is not a valid ISBN", isbn)
+	}
+	return isbn13(clean), nil
+}
+
+func (rec isbnRecord) metadata() isbnMetadata {
+	meta := isbnMetadata{Title: rec.Title, Author: rec.Author, Publisher: rec.Publisher}
+	if rec.Subtitle != "" {
+		meta.Title += ": " + rec.Subtitle
+	}
+	if meta.Author == "" && len(rec.AuthorName) > 0 {
+		meta.Author = strings.Join(rec.AuthorName, ", ")
+	}
+	if meta.Author == "" {
+		meta.Author = strings.TrimSuffix(strings.TrimPrefix(rec.ByStatement, "by "), ".")
+	}
+	if meta.Publisher == "" && len(rec.Publishers) > 0 {
+		meta.Publisher = rec.Publishers[0]
+	}
+	// "year" may be a number or a string depending on who made the dump
+	year := strings.Trim(string(rec.Year), `"`)
+	if year == "" || year == "null" {
+		year = rec.PublishDate
+	}
+	meta.Year, _ = strconv.Atoi(yearPattern.FindString(year))
+	return meta
+}
+
+// loadISBNIndex reads isbnDataFile into isbnIndex. Lines that are not valid JSON are skipped.
+// Open Library dumps are tab separated with the JSON record in the last column, so that works too.
+func loadISBNIndex() error {
+	file, err := os.Open(isbnDataFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	index := make(map[string]isbnMetadata)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024) // Some records are very long
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.LastIndexByte(line, '\t'); i >= 0 {
+			line = line[i+1:]
+		}
+		var rec isbnRecord
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			continue
+		}
+		meta := rec.metadata()
+		for _, isbn := range append(append([]string{rec.ISBN}, rec.ISBN13...), rec.ISBN10...) {
+			key, err := normalizeISBN(isbn)
+			if err != nil {
+				continue
+			}
+			if _, exists := index[key]; !exists {
+				meta.ISBN = cleanISBN(isbn)
+				index[key] = meta
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	isbnIndex = index
+	return nil
+}
+
+// lookupISBN finds metadata for isbn in the local dump, loading it the first time.
+func lookupISBN(isbn string) (isbnMetadata, bool, error) {
+	key, err := normalizeISBN(isbn)
+	if err != nil {
+		return isbnMetadata{}, false, err
+	}
+	if isbnIndex == nil {
+		if err := loadISBNIndex(); err != nil {
+			return isbnMetadata{}, false, fmt.Errorf("loading %s: %w", isbnDataFile, err)
+		}
+	}
+	meta, found := isbnIndex[key]
+	return meta, found, nil
+}
+
+func printISBNMetadata(meta isbnMetadata) {
+	fmt.Println("Title:    ", meta.Title)
+	fmt.Println("Author:   ", meta.Author)
+	fmt.Println("Publisher:", meta.Publisher)
+	if meta.Year != 0 {
+		fmt.Println("Year:     ", meta.Year)
+	} else {
+		fmt.Println("Year:      unknown")
+	}
+}
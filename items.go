@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Item is one physical copy of a book, identified by the barcode stuck on it.
+// A book without items is treated as a single copy, as before copies existed.
+type Item struct {
+	Barcode   string `json:"barcode"`             // Barcode identifies the copy, e.g. C000012
+	BookID    int    `json:"book_id"`             // BookID is the title this is a copy of
+	Condition string `json:"condition,omitempty"` // Condition is a free note, e.g. "good" or "torn cover"
+	Status    string `json:"status"`              // Status is one of itemStatuses
+}
+
+// Item statuses. Only available copies can be rented; on loan is set by RENT and RETURN.
+const (
+	statusAvailable = "available"
+	statusOnLoan    = "on loan"
+	statusLost      = "lost"
+	statusRepair    = "repair"
+)
+
+var itemStatuses = []string{statusAvailable, statusOnLoan, statusLost, statusRepair}
+
+var items = make(map[string]Item) // items maps a barcode to its copy
+var itemsFile = "items.json"      // itemsFile is the name of the file where copies are stored
+
+func loadItems() {
+	data, err := os.ReadFile(itemsFile)
+	if err != nil {
+		return // No copies registered yet
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		fmt.Println("Error reading items:", err)
+	}
+}
+
+func saveItems() {
+	if dryRunMode {
+		fmt.Println("(dry run) items not saved")
+		return
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving items:", err)
+		return
+	}
+	if err := os.WriteFile(itemsFile, data, 0644); err != nil {
+		fmt.Println("Error writing items file:", err)
+	}
+}
+
+// normalizeBarcode makes barcodes case-insensitive, as scanners and people type them differently.
+func normalizeBarcode(barcode string) string {
+	return strings.ToUpper(strings.TrimSpace(barcode))
+}
+
+// barcodeLooksLikeID reports whether barcode is a plain number. RENT and
+// RETURN try barcodes before book IDs, so such a copy would hide a book.
+func barcodeLooksLikeID(barcode string) bool {
+	_, err := strconv.Atoi(barcode)
+	return err == nil
+}
+
+// bookItems returns the copies of book bid, sorted by barcode.
+func bookItems(bid int) []Item {
+	copies := []Item{}
+	for _, item := range items {
+		if item.BookID == bid {
+			copies = append(copies, item)
+		}
+	}
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Barcode < copies[j].Barcode })
+	return copies
+}
+
+// availableCopies returns how many copies of book bid are on the shelf.
+func availableCopies(bid int) int {
+	copies := bookItems(bid)
+	if len(copies) == 0 {
+		if bookRenter(bid) == 0 {
+			return 1
+		}
+		return 0
+	}
+	count := 0
+	for _, item := range copies {
+		if item.Status == statusAvailable {
+			count++
+		}
+	}
+	return count
+}
+
+// copySummary describes the copies of book bid for READ, e.g. "2 of 3 available".
+func copySummary(bid int) string {
+	copies := bookItems(bid)
+	if len(copies) == 0 {
+		return fmt.Sprintf("%d of 1 available", availableCopies(bid))
+	}
+	counts := make(map[string]int)
+	for _, item := range copies {
+		counts[item.Status]++
+	}
+	summary := fmt.Sprintf("%d of %d available", counts[statusAvailable], len(copies))
+	for _, status := range []string{statusLost, statusRepair} {
+		if counts[status] > 0 {
+			summary += fmt.Sprintf(", %d %s", counts[status], status)
+		}
+	}
+	return summary
+}
+
+// nextBarcode returns the next free barcode of the form C000001.
+func nextBarcode() string {
+	highest := 0
+	for barcode := range items {
+		digits, found := strings.CutPrefix(barcode, "C")
+		if n, err := strconv.Atoi(digits); found && err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("C%06d", highest+1)
+}
+
+// addCopy registers a new copy of book bid. An empty barcode gets the next free one.
+func addCopy(bid int, barcode, condition string) (Item, error) {
+	if _, exists := books[bid]; !exists {
+		return Item{}, errors.New("book not found")
+	}
+	barcode = normalizeBarcode(barcode)
+	if barcode == "" {
+		barcode = nextBarcode()
+	}
+	if strings.ContainsAny(barcode, " \t") {
+		return Item{}, fmt.Errorf("barcode %q must not contain spaces", barcode)
+	}
+	if barcodeLooksLikeID(barcode) {
+		return Item{}, fmt.Errorf("barcode %s must contain a letter so it can't be mistaken for a book ID", barcode)
+	}
+	if _, exists := items[barcode]; exists {
+		return Item{}, fmt.Errorf("barcode %s is already used", barcode)
+	}
+	// The first copy of a book rented before copies existed is the one that is out
+	status := statusAvailable
+	if len(bookItems(bid)) == 0 && bookRenter(bid) != 0 {
+		status = statusOnLoan
+	}
+	item := Item{Barcode: barcode, BookID: bid, Condition: normalizeText(condition), Status: status}
+	items[barcode] = item
+	saveItems()
+	if status == statusOnLoan {
+		renter := bookRenter(bid)
+		v := visitors[renter]
+		if i := findLoan(v, bid); i != -1 {
+			v.Loans[i].Barcode = barcode
+			visitors[renter] = v
+			saveVisitors()
+		}
+	}
+	promoteHolds(bid)
+	return item, nil
+}
+
+// setCopyStatus marks a copy that is not on loan as available, lost or in repair.
+func setCopyStatus(barcode, status, condition string) (Item, error) {
+	item, exists := items[normalizeBarcode(barcode)]
+	if !exists {
+		return Item{}, errors.New("copy not found")
+	}
+	if item.Status == statusOnLoan {
+		return Item{}, errors.New("the copy is on loan, return it first")
+	}
+	if status == statusOnLoan {
+		return Item{}, errors.New("use RENT to lend a copy")
+	}
+	item.Status = status
+	if condition = normalizeText(condition); condition != "" {
+		item.Condition = condition
+	}
+	items[item.Barcode] = item
+	saveItems()
+	if status == statusAvailable {
+		promoteHolds(item.BookID)
+	}
+	return item, nil
+}
+
+// bookOrBarcode asks for a book by ID, title or the barcode of one of its
+// copies. barcode is "" unless a copy was scanned.
+func (p *prompter) bookOrBarcode(label string) (bid int, barcode string, err error) {
+	names := make(map[int]string)
+	for id, book := range books {
+		names[id] = book.Title
+	}
+	bid, err = p.idOr(label, names, func(text string) (int, bool) {
+		item, exists := items[normalizeBarcode(text)]
+		if exists {
+			barcode = item.Barcode
+		}
+		return item.BookID, exists
+	})
+	return bid, barcode, err
+}
+
+func handleAddCopy(p *prompter) error {
+	bid, err := p.bookID("Book ID: ")
+	if err != nil {
+		return err
+	}
+	if _, exists := books[bid]; !exists {
+		return errors.New("book not found")
+	}
+	barcode, err := p.line("Barcode (Enter for the next free one): ")
+	if err != nil {
+		return err
+	}
+	condition, err := p.line("Condition (Enter for none): ")
+	if err != nil {
+		return err
+	}
+	item, err := addCopy(bid, barcode, condition)
+	if err != nil {
+		return fmt.Errorf("could not add copy: %w", err)
+	}
+	fmt.Printf("Copy %s of %q added (%s).\n", item.Barcode, books[bid].Title, item.Status)
+	return nil
+}
+
+// handleCopies lists the copies of one book and who has them.
+func handleCopies(p *prompter) error {
+	bid, err := p.bookID("Book ID: ")
+	if err != nil {
+		return err
+	}
+	book, exists := books[bid]
+	if !exists {
+		return errors.New("book not found")
+	}
+	fmt.Printf("ID: %d, Title: %s, Copies: %s\n", book.ID, book.Title, copySummary(bid))
+	for _, item := range bookItems(bid) {
+		status := item.Status
+		if vid, loan, found := itemLoan(item.Barcode); found {
+			status += fmt.Sprintf(" to %s, due %s", visitors[vid].Name, loan.Due.Format("2006-01-02"))
+		}
+		fmt.Printf("  %s  %-14s %s\n", item.Barcode, orNone(item.Condition), status)
+	}
+	p.waitForReturn()
+	return nil
+}
+
+func handleMarkCopy(p *prompter) error {
+	barcode, err := p.text("Barcode: ")
+	if err != nil {
+		return err
+	}
+	if _, exists := items[normalizeBarcode(barcode)]; !exists {
+		return errors.New("copy not found")
+	}
+	status, err := p.choice("Status (available/lost/repair): ", []string{statusAvailable, statusLost, statusRepair})
+	if err != nil {
+		return err
+	}
+	condition, err := p.line("Condition (Enter to keep): ")
+	if err != nil {
+		return err
+	}
+	item, err := setCopyStatus(barcode, status, condition)
+	if err != nil {
+		return fmt.Errorf("could not change copy: %w", err)
+	}
+	fmt.Printf("Copy %s is now %s.\n", item.Barcode, item.Status)
+	return nil
+}
+
+// itemLoan finds the loan of the copy with barcode.
+func itemLoan(barcode string) (vid int, loan Loan, found bool) {
+	for _, id := range sortedVisitorIDs() {
+		for _, loan := range visitors[id].Loans {
+			if loan.Barcode == barcode {
+				return id, loan, true
+			}
+		}
+	}
+	return 0, Loan{}, false
+}
+
+// unlinkedCopy returns the barcode of a copy of book bid that is on loan but
+// not to anyone in particular: the first copy registered for a book that was
+// already out under a loan without due dates.
+func unlinkedCopy(bid int) string {
+	for _, item := range bookItems(bid) {
+		if _, _, found := itemLoan(item.Barcode); item.Status == statusOnLoan && !found {
+			return item.Barcode
+		}
+	}
+	return ""
+}
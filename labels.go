@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// The label sheet is A4 with 3 x 8 labels of 70 x 37 mm and no margins
+// (e.g. Avery 3474). All layout is in millimetres from the top left corner.
+const (
+	sheetWidth    = 210.0
+	sheetHeight   = 297.0
+	labelColumns  = 3
+	labelRows     = 8
+	labelWidth    = sheetWidth / labelColumns
+	labelHeight   = 37.0
+	labelPadding  = 4.0
+	labelsPerPage = labelColumns * labelRows
+)
+
+// labelShape is a filled rectangle or a line of text on a page.
+type labelShape struct {
+	Text       string  // Text is "" for a rectangle
+	X, Y       float64 // X, Y is the top left of a rectangle, or where a text line starts on its baseline
+	W, H       float64 // W, H is the size of a rectangle
+	FontSize   float64 // FontSize is the text height in millimetres
+	Bold       bool
+	Monospaced bool
+}
+
+// labelPage is everything drawn on one sheet.
+type labelPage []labelShape
+
+// label is what is printed on one label.
+type label struct {
+	Title      string
+	CallNumber string
+	Barcode    string
+}
+
+// callNumber returns a simple shelf mark: the first three letters of the
+// author's surname and the year, e.g. "HER 1965".
+func callNumber(book Book) string {
+	surname := []rune(strings.ToUpper(authorSurname(book.Author)))
+	if len(surname) > 3 {
+		surname = surname[:3]
+	}
+	mark := string(surname)
+	if book.Year != 0 {
+		mark += " " + strconv.Itoa(book.Year)
+	}
+	return strings.TrimSpace(mark)
+}
+
+// shorten cuts s to at most n characters, marking the cut with "...".
+func shorten(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
+
+// layoutLabels places the labels on as many pages as they need.
+func layoutLabels(labels []label) ([]labelPage, error) {
+	pages := []labelPage{}
+	for i, l := range labels {
+		if i%labelsPerPage == 0 {
+			pages = append(pages, labelPage{})
+		}
+		slot := i % labelsPerPage
+		left := float64(slot%labelColumns)*labelWidth + labelPadding
+		top := float64(slot/labelColumns)*labelHeight + labelPadding
+		width := labelWidth - 2*labelPadding
+
+		page := &pages[len(pages)-1]
+		*page = append(*page,
+			labelShape{Text: shorten(l.Title, 34), X: left, Y: top + 3, FontSize: 3.2, Bold: true},
+			labelShape{Text: l.CallNumber, X: left, Y: top + 7.5, FontSize: 2.8},
+		)
+
+		barTop, barHeight := top+10, 13.0
+		bars, module, err := barcodeShapes(l.Barcode, left, barTop, width, barHeight)
+		if err != nil {
+			return nil, err
+		}
+		*page = append(*page, bars...)
+		*page = append(*page, labelShape{Text: l.Barcode, X: left + code128Quiet*module, Y: barTop + barHeight + 3.5, FontSize: 3, Monospaced: true})
+	}
+	return pages, nil
+}
+
+// barcodeShapes draws text as a Code 128 barcode in the box at left, top of
+// width x height millimetres, quiet zones included, and returns the bars and
+// the module width used.
+func barcodeShapes(text string, left, top, width, height float64) ([]labelShape, float64, error) {
+	widths, err := encodeCode128(text)
+	if err != nil {
+		return nil, 0, fmt.Errorf("barcode %s: %w", text, err)
+	}
+	// Use the widest bars that fit, but not so wide that short codes look odd
+	module := min(width/float64(code128Modules(widths)), 0.5)
+	x := left + code128Quiet*module
+	bars := []labelShape{}
+	for i, w := range widths {
+		if i%2 == 0 { // Even positions are bars, odd ones spaces
+			bars = append(bars, labelShape{X: x, Y: top, W: float64(w) * module, H: height})
+		}
+		x += float64(w) * module
+	}
+	return bars, module, nil
+}
+
+// writeLabelsSVG draws one page as an SVG image sized in millimetres.
+func writeLabelsSVG(w io.Writer, page labelPage) error {
+	return writeSVG(w, sheetWidth, sheetHeight, page)
+}
+
+// writeSVG draws shapes on a white SVG image of width x height millimetres.
+func writeSVG(w io.Writer, width, height float64, shapes []labelShape) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%gmm\" height=\"%gmm\" viewBox=\"0 0 %g %g\">\n", width, height, width, height)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	for _, s := range shapes {
+		if s.Text == "" {
+			fmt.Fprintf(&b, "<rect x=\"%.3f\" y=\"%.3f\" width=\"%.3f\" height=\"%.3f\"/>\n", s.X, s.Y, s.W, s.H)
+			continue
+		}
+		family, weight := "Helvetica, Arial, sans-serif", "normal"
+		if s.Monospaced {
+			family = "Courier, monospace"
+		}
+		if s.Bold {
+			weight = "bold"
+		}
+		fmt.Fprintf(&b, "<text x=\"%.3f\" y=\"%.3f\" font-family=\"%s\" font-size=\"%.2f\" font-weight=\"%s\">%s</text>\n",
+			s.X, s.Y, family, s.FontSize, weight, html.EscapeString(s.Text))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// pdfText encodes s for a PDF string in the standard fonts' WinAnsi encoding.
+func pdfText(s string) string {
+	encoded, err := encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder()).String(s)
+	if err != nil {
+		encoded = s
+	}
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(encoded)
+}
+
+// writePDF writes A4 pages as one PDF using only the built-in fonts,
+// so nothing has to be embedded or downloaded.
+func writePDF(w io.Writer, pages []labelPage) error {
+	const pt = 72 / 25.4 // points per millimetre
+	var out bytes.Buffer
+	offsets := []int{} // offsets[i] is where object i+1 starts
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// Objects 1-5: catalog, page tree and fonts; each page then adds a page and a content object
+	kids := []string{}
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content strings.Builder
+		for _, s := range page {
+			if s.Text == "" {
+				fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re f\n", s.X*pt, (sheetHeight-s.Y-s.H)*pt, s.W*pt, s.H*pt)
+				continue
+			}
+			font := "F1"
+			if s.Bold {
+				font = "F2"
+			}
+			if s.Monospaced {
+				font = "F3"
+			}
+			fmt.Fprintf(&content, "BT /%s %.2f Tf %.3f %.3f Td (%s) Tj ET\n", font, s.FontSize*pt, s.X*pt, (sheetHeight-s.Y)*pt, pdfText(s.Text))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			sheetWidth*pt, sheetHeight*pt, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// selectLabels turns a selection like "1, 3 C000007" or "ALL" into labels:
+// a book ID gives a label for each of its copies, a barcode one label.
+func selectLabels(selection string) ([]label, error) {
+	labels := []label{}
+	add := func(item Item) {
+		book := books[item.BookID]
+		labels = append(labels, label{Title: book.Title, CallNumber: callNumber(book), Barcode: item.Barcode})
+	}
+
+	words := strings.FieldsFunc(selection, func(r rune) bool { return r == ',' || r == ' ' })
+	for _, word := range words {
+		if strings.EqualFold(word, "all") {
+			for _, barcode := range sortedBarcodes() {
+				add(items[barcode])
+			}
+			continue
+		}
+		if item, exists := items[normalizeBarcode(word)]; exists {
+			add(item)
+			continue
+		}
+		id, err := strconv.Atoi(word)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a book ID or barcode", word)
+		}
+		if _, exists := books[id]; !exists {
+			return nil, fmt.Errorf("book %d not found", id)
+		}
+		copies := bookItems(id)
+		if len(copies) == 0 {
+			return nil, fmt.Errorf("book %d has no copies to label, add some with ADDCOPY", id)
+		}
+		for _, item := range copies {
+			add(item)
+		}
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("nothing to label")
+	}
+	return labels, nil
+}
+
+// writeLabels lays out the labels and saves them as SVG (one file per page)
+// or PDF, depending on the extension of path. It returns the files written.
+func writeLabels(labels []label, path string) ([]string, error) {
+	pages, err := layoutLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".pdf":
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return []string{path}, writePDF(file, pages)
+	case ".svg":
+		written := []string{}
+		for i, page := range pages {
+			name := path
+			if i > 0 { // labels.svg, labels-2.svg, ...
+				name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, filepath.Ext(path)), i+1, filepath.Ext(path))
+			}
+			file, err := os.Create(name)
+			if err != nil {
+				return written, err
+			}
+			err = writeLabelsSVG(file, page)
+			file.Close()
+			if err != nil {
+				return written, err
+			}
+			written = append(written, name)
+		}
+		return written, nil
+	}
+	return nil, fmt.Errorf("unknown label format %q, use a .svg or .pdf file", ext)
+}
+
+func handleLabels(p *prompter) error {
+	var labels []label
+	for labels == nil {
+		selection, err := p.text("Book IDs or barcodes to label (or ALL): ")
+		if err != nil {
+			return err
+		}
+		labels, err = selectLabels(selection)
+		if err != nil {
+			p.retry("%v", err)
+		}
+	}
+
+	path, err := p.line("Output file (.svg or .pdf, Enter for labels.svg): ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "labels.svg"
+	}
+	written, err := writeLabels(labels, path)
+	if err != nil {
+		return fmt.Errorf("writing labels: %w", err)
+	}
+	fmt.Printf("%d label(s) written to %s.\n", len(labels), strings.Join(written, ", "))
+	return nil
+}
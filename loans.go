@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Loan records when a visitor rented a book and when it is due back.
+// Books rented before loans were recorded have no Loan.
+type Loan struct {
+	BookID   int       `json:"book_id"`           // BookID is the rented book
+	Barcode  string    `json:"barcode,omitempty"` // Barcode is the copy lent, "" for books without copies
+	Rented   time.Time `json:"rented"`            // Rented is when the book was rented
+	Due      time.Time `json:"due"`               // Due is when the book must be back
+	Renewals int       `json:"renewals"`          // Renewals is how many times the loan has been extended
+}
+
+// findLoan returns the index of v's loan of book bid, or -1.
+func findLoan(v Visitor, bid int) int {
+	for i, loan := range v.Loans {
+		if loan.BookID == bid {
+			return i
+		}
+	}
+	return -1
+}
+
+// newLoan starts a loan of book bid under the rules of v's category.
+func newLoan(v Visitor, bid int) Loan {
+	_, rules := visitorCategory(v)
+	now := clock.Now()
+	return Loan{BookID: bid, Rented: now, Due: now.AddDate(0, 0, rules.LoanDays)}
+}
+
+// renewLoan extends visitor vid's loan of book bid by another loan period.
+func renewLoan(vid, bid int) (Loan, error) {
+	visitor, exists := visitors[vid]
+	if !exists {
+		return Loan{}, errors.New("visitor not found")
+	}
+	index := findLoan(visitor, bid)
+	if index == -1 {
+		for _, rid := range visitor.RentedIDs {
+			if rid == bid {
+				return Loan{}, errors.New("this loan was made before due dates were kept and has none to extend")
+			}
+		}
+		return Loan{}, errors.New("this book is not currently rented by the visitor")
+	}
+	if err := checkMembership(visitor); err != nil {
+		return Loan{}, err
+	}
+	name, rules := visitorCategory(visitor)
+	loan := visitor.Loans[index]
+	if loan.Renewals >= rules.Renewals {
+		return Loan{}, fmt.Errorf("the loan was already renewed %d time(s), the most for the %s category", loan.Renewals, name)
+	}
+	if queue := holdQueue(bid); len(queue) > 0 {
+		return Loan{}, fmt.Errorf("%d other visitor(s) are waiting for this book", len(queue))
+	}
+
+	// Extend from today if the book is already overdue, so renewing never leaves it overdue
+	from := loan.Due
+	if now := clock.Now(); now.After(from) {
+		from = now
+	}
+	loan.Due = from.AddDate(0, 0, rules.LoanDays)
+	loan.Renewals++
+	visitor.Loans[index] = loan
+	visitors[vid] = visitor
+	saveVisitors()
+	return loan, nil
+}
+
+func handleRenew(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID: ")
+	if err != nil {
+		return err
+	}
+	if _, exists := visitors[vid]; !exists {
+		return errors.New("visitor not found")
+	}
+	bid, err := p.bookID("Book ID to renew: ")
+	if err != nil {
+		return err
+	}
+	loan, err := renewLoan(vid, bid)
+	if err != nil {
+		return fmt.Errorf("could not renew: %w", err)
+	}
+	fmt.Println("Loan renewed, now due", loan.Due.Format("2006-01-02")+".")
+	return nil
+}
@@ -1,368 +1,928 @@
-package main
-
-/*
-	This Go program implements a CRUD (Create, Read, Update, Delete) application for managing a library system.
-	It supports functionalities such as adding, updating, deleting, and searching for books
- 	as well as managing visitors who can rent and return books.
- 	The program uses JSON files to persist data across runs, and it provides a command-line interface
-
-	things I learned:
-	1. How to use the "encoding/json" package to marshal and unmarshal data.
-		Marshal means to convert Go data structures into JSON format.
-		Unmarshal means to convert JSON data back into Go data structures.
-	2. How to read and write files in Go using the "os" package.
-		Reading files is done using os.ReadFile, and writing files is done using os.WriteFile.
-	3. How to use the "bufio" package to read input from the console.
-		It allows for buffered input reading, which is efficient for console applications.
-	4. How to use slices in Go to manage collections of data.
-		Slices are dynamic arrays that can grow and shrink in size.
-*/
-
-import (
-	"bufio"         // "bufio" is used for reading input from the console
-	"encoding/json" // "encoding/json" is used for encoding and decoding JSON data
-	"fmt"           // "fmt" is used for formatted I/O operations
-	"os"            // "os" is used for operating system functionality, like reading and writing files
-	"strings"       // "strings" is used for string manipulation, such as trimming spaces and converting to lower case
-)
-
-type Book struct {
-	ID     int    `json:"id"`     // ID is the unique identifier for each book
-	Title  string `json:"title"`  // Title is the title of the book
-	Author string `json:"author"` // Author is the author of the book
-}
-type Visitor struct {
-	ID        int    `json:"id"`             // ID is the unique identifier for each visitor
-	Name      string `json:"name"`           // Name is the name of the visitor
-	RentedIDs []int  `json:"rented_book_id"` // RentedIDs is a slice of book IDs that the visitor has rented
-}
-
-var books = make(map[int]Book)       // books is a slice that holds all the books in the library
-var nextID = 1                       // nextID is the next available ID for a new book
-var dataFile = "books.json"          // dataFile is the name of the file where books data is stored
-var visitors = make(map[int]Visitor) // visitors is a slice that holds all the visitors
-var nextVisitorID = 1                // nextVisitorID is the next available ID for a new visitor
-var visitorsFile = "visitors.json"   // visitorsFile is the name of the file where visitors data is stored
-
-func waitForReturn(scanner *bufio.Scanner) {
-	fmt.Print("\npress Enter to return: ")
-	scanner.Scan()         // Wait for the user to press Enter
-	text := scanner.Text() // Read the input
-	if text != "" {        // If the input is not empty, print a message
-		waitForReturn(scanner)
-	}
-}
-
-func loadVisitors() {
-	data, err := os.ReadFile(visitorsFile) // Read the visitors file
-	if err != nil {                        // If the file does not exist, we start with an empty slice
-		fmt.Println("No visitors file found.")
-		return
-	}
-	err = json.Unmarshal(data, &visitors) // Unmarshal the JSON data into the visitors slice
-	if err != nil {                       // If there is an error reading the JSON, print an error message
-		fmt.Println("Error reading visitors:", err)
-		return
-	}
-	for _, v := range visitors {
-		if v.ID >= nextVisitorID {
-			nextVisitorID = v.ID + 1
-		}
-	}
-}
-
-func saveVisitors() {
-	data, err := json.MarshalIndent(visitors, "", "  ")
-	if err != nil {
-		fmt.Println("Error saving visitors:", err)
-		return
-	}
-	err = os.WriteFile(visitorsFile, data, 0644)
-	if err != nil {
-		fmt.Println("Error writing visitors file:", err)
-	}
-}
-
-func loadBooks() {
-	data, err := os.ReadFile(dataFile)
-	if err != nil {
-		fmt.Println("No data file found, starting fresh.")
-		return
-	}
-
-	err = json.Unmarshal(data, &books)
-	if err != nil {
-		fmt.Println("Error reading JSON:", err)
-		return
-	}
-	// Find max ID to set nextID
-	nextID = 1
-	for id := range books {
-		if id >= nextID {
-			nextID = id + 1
-		}
-	}
-}
-
-func saveBooks() {
-	data, err := json.MarshalIndent(books, "", "  ")
-	if err != nil {
-		fmt.Println("Error saving books:", err)
-		return
-	}
-	err = os.WriteFile(dataFile, data, 0644)
-	if err != nil {
-		fmt.Println("Error writing file:", err)
-	}
-}
-
-func createBook(title, author string) {
-	book := Book{ID: nextID, Title: title, Author: author}
-	books[nextID] = book
-	nextID++
-	saveBooks()
-	fmt.Println("Book created:", book)
-}
-
-func searchBooks(query string) {
-	query = strings.ToLower(query)
-	found := false
-
-	for _, book := range books {
-		if strings.Contains(strings.ToLower(book.Title), query) {
-			fmt.Printf("ID: %d, Title: %s, Author: %s\n", book.ID, book.Title, book.Author)
-			found = true
-		}
-	}
-
-	if !found {
-		fmt.Println("No books found matching your search.")
-	}
-}
-
-func readBooks() {
-	if len(books) == 0 {
-		fmt.Println("No books found.")
-		return
-	}
-	for _, book := range books {
-		fmt.Printf("ID: %d, Title: %s, Author: %s\n", book.ID, book.Title, book.Author)
-	}
-}
-
-func updateBook(id int, newTitle, newAuthor string) {
-	book, exists := books[id]
-	if !exists {
-		fmt.Println("Book not found")
-		return
-	}
-	book.Title = newTitle
-	book.Author = newAuthor
-	books[id] = book
-	saveBooks()
-	fmt.Println("Book updated:", book)
-}
-
-func deleteBook(id int) {
-	if _, exists := books[id]; exists {
-		delete(books, id)
-		saveBooks()
-		fmt.Println("Book deleted:", id)
-	} else {
-		fmt.Println("Book not found")
-	}
-}
-
-func showVisitors(scanner *bufio.Scanner) {
-	for _, v := range visitors {
-		renting := "none"
-		if len(v.RentedIDs) > 0 {
-			ids := []string{}
-			for _, id := range v.RentedIDs {
-				ids = append(ids, fmt.Sprintf("%d", id))
-			}
-			renting = "Book ID(s) " + strings.Join(ids, ", ")
-		}
-		fmt.Printf("ID: %d, Name: %s, Renting: %s\n", v.ID, v.Name, renting)
-	}
-	waitForReturn(scanner)
-}
-
-func addVisitor(scanner *bufio.Scanner) {
-	fmt.Print("Enter visitor name: ")
-	scanner.Scan()
-	name := scanner.Text()
-
-	visitor := Visitor{ID: nextVisitorID, Name: name}
-	visitors[nextVisitorID] = visitor
-	nextVisitorID++
-	saveVisitors()
-	fmt.Println("Visitor added.")
-}
-
-func rentBook(scanner *bufio.Scanner) {
-	fmt.Print("Visitor ID: ")
-	var vid int
-	fmt.Scanln(&vid)
-
-	visitor, exists := visitors[vid]
-	if !exists {
-		fmt.Println("Visitor not found.")
-		return
-	}
-
-	fmt.Print("Book ID to rent: ")
-	var bid int
-	fmt.Scanln(&bid)
-
-	var bookExists bool
-	for _, book := range books {
-		if book.ID == bid {
-			bookExists = true
-			break
-		}
-	}
-	if !bookExists {
-		fmt.Println("Book not found.")
-		return
-	}
-
-	for _, rid := range visitor.RentedIDs {
-		if rid == bid {
-			fmt.Println("Visitor already rented this book.")
-			return
-		}
-	}
-	visitor.RentedIDs = append(visitor.RentedIDs, bid)
-
-	// Important: Save updated visitor back to map
-	visitors[vid] = visitor
-	saveVisitors()
-	fmt.Println("Book rented.")
-}
-
-func returnBook(scanner *bufio.Scanner) {
-	fmt.Print("Visitor ID: ")
-	var vid int
-	fmt.Scanln(&vid)
-
-	visitor, found := visitors[vid]
-	if !found {
-		fmt.Println("Visitor not found.")
-		waitForReturn(scanner)
-		return
-	}
-
-	fmt.Print("Book ID to return: ")
-	var bid int
-	fmt.Scanln(&bid)
-
-	index := -1
-	for i, id := range visitor.RentedIDs {
-		if id == bid {
-			index = i
-			break
-		}
-	}
-
-	if index == -1 {
-		fmt.Println("This book is not currently rented by the visitor.")
-	} else {
-		// Remove the book ID from the RentedIDs slice
-		visitor.RentedIDs = append(visitor.RentedIDs[:index], visitor.RentedIDs[index+1:]...)
-		// Save the updated visitor struct back into the map
-		visitors[vid] = visitor
-		saveVisitors()
-		fmt.Println("Book returned.")
-	}
-
-	waitForReturn(scanner)
-}
-
-func handleCreate(scanner *bufio.Scanner) {
-	fmt.Print("Enter title: ")
-	scanner.Scan()
-	title := scanner.Text()
-
-	fmt.Print("Enter author: ")
-	scanner.Scan()
-	author := scanner.Text()
-
-	createBook(title, author)
-}
-
-func handleUpdate(scanner *bufio.Scanner) {
-	fmt.Print("Enter ID to update: ")
-	var id int
-	fmt.Scanln(&id)
-
-	fmt.Print("Enter new title: ")
-	scanner.Scan()
-	newTitle := scanner.Text()
-
-	fmt.Print("Enter new author: ")
-	scanner.Scan()
-	newAuthor := scanner.Text()
-	updateBook(id, newTitle, newAuthor)
-}
-
-const Green = "\033[32m"
-const Reset = "\033[0m"
-
-func main() {
-	loadBooks()
-	loadVisitors()
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Println(Green + "\nAvailable commands: \n\nVisitors Commands\n[VISITORS] [ADDVISITOR] [RENT] \n[RETURN]\n\nBooks Commands\n[CREATE] [READ] [SEARCH] \n[UPDATE] [DELETE] [EXIT]\n" + Reset)
-		fmt.Print("Enter command: ")
-
-		if !scanner.Scan() {
-			break
-		}
-		cmd := strings.ToUpper(strings.TrimSpace(scanner.Text()))
-		switch cmd {
-		case "VISITORS":
-			showVisitors(scanner)
-
-		case "ADDVISITOR":
-			addVisitor(scanner)
-
-		case "RENT":
-			rentBook(scanner)
-
-		case "RETURN":
-			returnBook(scanner)
-
-		case "CREATE":
-			handleCreate(scanner)
-
-		case "READ":
-			readBooks()
-			waitForReturn(scanner)
-
-		case "SEARCH":
-			fmt.Print("Enter title keyword to search: ")
-			scanner.Scan()
-			query := scanner.Text()
-			searchBooks(query)
-			waitForReturn(scanner)
-
-		case "UPDATE":
-			handleUpdate(scanner)
-
-		case "DELETE":
-			fmt.Print("Enter ID to delete: ")
-			var id int
-			fmt.Scanln(&id)
-			deleteBook(id)
-
-		case "EXIT":
-			fmt.Println("Goodbye!")
-			return
-
-		default:
-			fmt.Println("Unknown command.")
-		}
-	}
-}
+package main
+
+/*
+	This Go program implements a CRUD (Create, Read, Update, Delete) application for managing a library system.
+	It supports functionalities such as adding, updating, deleting, and searching for books
+ 	as well as managing visitors who can rent and return books.
+ 	The program uses JSON files to persist data across runs, and it provides a command-line interface
+
+	things I learned:
+	1. How to use the "encoding/json" package to marshal and unmarshal data.
+		Marshal means to convert Go data structures into JSON format.
+		Unmarshal means to convert JSON data back into Go data structures.
+	2. How to read and write files in Go using the "os" package.
+		Reading files is done using os.ReadFile, and writing files is done using os.WriteFile.
+	3. How to use the "bufio" package to read input from the console.
+		It allows for buffered input reading, which is efficient for console applications.
+	4. How to use slices in Go to manage collections of data.
+		Slices are dynamic arrays that can grow and shrink in size.
+*/
+
+import (
+	"encoding/json" // "encoding/json" is used for encoding and decoding JSON data
+	"errors"        // "errors" is used to create the errors returned by the core library operations
+	"flag"          // "flag" is used to parse command-line options
+	"fmt"           // "fmt" is used for formatted I/O operations
+	"os"            // "os" is used for operating system functionality, like reading and writing files
+	"strings"       // "strings" is used for string manipulation, such as trimming spaces and converting to lower case
+	"time"          // "time" is used for membership dates
+)
+
+type Book struct {
+	ID        int    `json:"id"`                  // ID is the unique identifier for each book
+	Title     string `json:"title"`               // Title is the title of the book
+	Author    string `json:"author"`              // Author is the author of the book
+	ISBN      string `json:"isbn,omitempty"`      // ISBN is the book's ISBN-10 or ISBN-13, if known
+	Publisher string `json:"publisher,omitempty"` // Publisher is the name of the publisher, if known
+	Year      int    `json:"year,omitempty"`      // Year is the year of publication, 0 if unknown
+}
+type Visitor struct {
+	ID        int       `json:"id"`                 // ID is the unique identifier for each visitor
+	Name      string    `json:"name"`               // Name is the name of the visitor
+	RentedIDs []int     `json:"rented_book_id"`     // RentedIDs is a slice of book IDs that the visitor has rented
+	Category  string    `json:"category,omitempty"` // Category decides the borrowing rules, see categories
+	Loans     []Loan    `json:"loans,omitempty"`    // Loans has the dates of the books in RentedIDs
+	Card      string    `json:"card,omitempty"`     // Card is the library card number, e.g. P0000018
+	Email     string    `json:"email,omitempty"`    // Email is where reminders go
+	Phone     string    `json:"phone,omitempty"`    // Phone is a number to call, free format
+	Address   string    `json:"address,omitempty"`  // Address is the postal address on one line
+	Joined    time.Time `json:"joined,omitzero"`    // Joined is the day the visitor became a member
+	Expires   time.Time `json:"expires,omitzero"`   // Expires is the last day of the membership; zero never expires
+	Notes     string    `json:"notes,omitempty"`    // Notes is anything staff want to remember
+}
+
+var books = make(map[int]Book)       // books is a slice that holds all the books in the library
+var nextID = 1                       // nextID is the next available ID for a new book
+var dataFile = "books.json"          // dataFile is the name of the file where books data is stored
+var visitors = make(map[int]Visitor) // visitors is a slice that holds all the visitors
+var nextVisitorID = 1                // nextVisitorID is the next available ID for a new visitor
+var visitorsFile = "visitors.json"   // visitorsFile is the name of the file where visitors data is stored
+var dryRunMode = false               // dryRunMode shows every change but never writes the data files
+var assumeYes = false                // assumeYes answers yes to every confirmation, for scripts
+
+func loadVisitors() {
+	data, err := os.ReadFile(visitorsFile) // Read the visitors file
+	if err != nil {                        // If the file does not exist, we start with an empty slice
+		fmt.Println("No visitors file found.")
+		return
+	}
+	err = json.Unmarshal(data, &visitors) // Unmarshal the JSON data into the visitors slice
+	if err != nil {                       // If there is an error reading the JSON, print an error message
+		fmt.Println("Error reading visitors:", err)
+		return
+	}
+	for _, v := range visitors {
+		if v.ID >= nextVisitorID {
+			nextVisitorID = v.ID + 1
+		}
+	}
+}
+
+func saveVisitors() {
+	if dryRunMode {
+		fmt.Println("(dry run) visitors not saved")
+		return
+	}
+	data, err := json.MarshalIndent(visitors, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving visitors:", err)
+		return
+	}
+	err = os.WriteFile(visitorsFile, data, 0644)
+	if err != nil {
+		fmt.Println("Error writing visitors file:", err)
+	}
+}
+
+func loadBooks() {
+	data, err := os.ReadFile(dataFile)
+	if err != nil {
+		fmt.Println("No data file found, starting fresh.")
+		return
+	}
+
+	err = json.Unmarshal(data, &books)
+	if err != nil {
+		fmt.Println("Error reading JSON:", err)
+		return
+	}
+	// Find max ID to set nextID
+	nextID = 1
+	for id := range books {
+		if id >= nextID {
+			nextID = id + 1
+		}
+	}
+}
+
+func saveBooks() {
+	if dryRunMode {
+		fmt.Println("(dry run) books not saved")
+		return
+	}
+	data, err := json.MarshalIndent(books, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving books:", err)
+		return
+	}
+	err = os.WriteFile(dataFile, data, 0644)
+	if err != nil {
+		fmt.Println("Error writing file:", err)
+	}
+}
+
+// createBook validates book, gives it the next ID and saves the books file.
+func createBook(book Book) error {
+	book, err := validateBook(book)
+	if err != nil {
+		return err
+	}
+	book.ID = nextID
+	books[nextID] = book
+	nextID++
+	saveBooks()
+	fmt.Println("Book created:", book)
+	return nil
+}
+
+// addBook creates book after asking whether to go ahead when it looks like a
+// book already in the catalog.
+func addBook(p *prompter, book Book) error {
+	book, err := validateBook(book)
+	if err != nil {
+		return err
+	}
+	if other, found := findDuplicateBook(book); found {
+		fmt.Printf("A similar book already exists: ID %d, %q by %s\n", other.ID, other.Title, other.Author)
+		if err := p.confirm("Add it anyway? (y/n): "); err != nil {
+			return err
+		}
+	}
+	return createBook(book)
+}
+
+func searchBooks(query string) {
+	found := false
+
+	for _, book := range books {
+		if matchesQuery(book.Title, query) {
+			fmt.Printf("ID: %d, Title: %s, Author: %s\n", book.ID, book.Title, book.Author)
+			found = true
+		}
+	}
+
+	if !found {
+		fmt.Println("No books found matching your search.")
+	}
+}
+
+func readBooks() {
+	if len(books) == 0 {
+		fmt.Println("No books found.")
+		return
+	}
+	for _, book := range books {
+		fmt.Printf("ID: %d, Title: %s, Author: %s, Copies: %s\n", book.ID, book.Title, book.Author, copySummary(book.ID))
+	}
+}
+
+// editBook sets the given fields (see bookFields) of book id and saves the
+// books file. Fields not in changes keep their value.
+func editBook(id int, changes map[string]string) (Book, error) {
+	book, exists := books[id]
+	if !exists {
+		return Book{}, errors.New("book not found")
+	}
+	for field, value := range changes {
+		if err := setBookField(&book, field, value); err != nil {
+			return Book{}, err
+		}
+	}
+	books[id] = book
+	saveBooks()
+	return book, nil
+}
+
+func updateBook(id int, changes map[string]string) error {
+	book, err := editBook(id, changes)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Book updated:", book)
+	return nil
+}
+
+// printBook shows one book in the same layout as READ.
+func printBook(book Book) {
+	fmt.Printf("ID: %d, Title: %s, Author: %s\n", book.ID, book.Title, book.Author)
+}
+
+func deleteBook(id int) error {
+	if _, exists := books[id]; !exists {
+		return errors.New("book not found")
+	}
+	delete(books, id)
+	saveBooks()
+	if removeHolds(func(h Hold) bool { return h.BookID == id }) {
+		saveHolds()
+	}
+	if copies := bookItems(id); len(copies) > 0 {
+		for _, item := range copies {
+			delete(items, item.Barcode)
+		}
+		saveItems()
+	}
+	fmt.Println("Book deleted:", id)
+	return nil
+}
+
+func showVisitors(p *prompter) error {
+	for _, v := range visitors {
+		renting := "none"
+		if len(v.RentedIDs) > 0 {
+			ids := []string{}
+			for _, id := range v.RentedIDs {
+				ids = append(ids, fmt.Sprintf("%d", id))
+			}
+			renting = "Book ID(s) " + strings.Join(ids, ", ")
+		}
+		category, _ := visitorCategory(v)
+		fmt.Printf("ID: %d, Name: %s, Card: %s, Category: %s, Renting: %s, Balance: %s\n", v.ID, v.Name, orNone(v.Card), category, renting, formatMoney(balance(v.ID)))
+	}
+	p.waitForReturn()
+	return nil
+}
+
+func addVisitor(p *prompter) error {
+	// ADDVISITOR "Ada Lovelace" email=ada@example.com asks nothing else;
+	// typed at the menu, the contact details are asked for too
+	quick := p.hasArgs()
+	assignments := p.takeAssignments(visitorFields)
+	name, err := p.text("Enter visitor name: ")
+	if err != nil {
+		return err
+	}
+
+	visitor, err := validateVisitor(Visitor{Name: name})
+	if err != nil {
+		return err
+	}
+	for _, arg := range assignments {
+		field, value, err := parseAssignment(arg)
+		if err != nil {
+			return err
+		}
+		if field != "email" && field != "phone" && field != "address" && field != "notes" {
+			return fmt.Errorf("%s can't be set here, change it with PROFILE once the visitor is added", field)
+		}
+		if err := setVisitorField(&visitor, field, value); err != nil {
+			return err
+		}
+	}
+	if !quick {
+		for _, field := range []string{"email", "phone", "address"} {
+			for {
+				value, err := p.line(visitorFieldLabels[field] + " (Enter to skip): ")
+				if err != nil {
+					return err
+				}
+				if err := setVisitorField(&visitor, field, value); err != nil {
+					p.retry("%v", err)
+					continue
+				}
+				break
+			}
+		}
+	}
+	if other, found := findDuplicateVisitor(visitor); found {
+		fmt.Printf("A visitor with this name already exists: ID %d, %s\n", other.ID, other.Name)
+		if err := p.confirm("Add another one? (y/n): "); err != nil {
+			return err
+		}
+	}
+
+	visitor.ID = nextVisitorID
+	visitor.Card = nextCardNumber()
+	newMembership(&visitor)
+	visitors[nextVisitorID] = visitor
+	nextVisitorID++
+	saveVisitors()
+	fmt.Printf("Visitor added with card number %s, member until %s. Print the card with CARD.\n", visitor.Card, formatDate(visitor.Expires))
+	return nil
+}
+
+// rentBookTo records that visitor vid is renting book bid and saves the visitors file.
+// The first available copy is lent.
+func rentBookTo(vid, bid int) error {
+	_, err := rentCopy(vid, bid, "")
+	return err
+}
+
+// rentCopy lends visitor vid the copy of book bid with barcode, or any
+// available copy when barcode is "", and returns the new loan.
+func rentCopy(vid, bid int, barcode string) (Loan, error) {
+	visitor, exists := visitors[vid]
+	if !exists {
+		return Loan{}, errors.New("visitor not found")
+	}
+	if _, exists := books[bid]; !exists {
+		return Loan{}, errors.New("book not found")
+	}
+	for _, rid := range visitor.RentedIDs {
+		if rid == bid {
+			return Loan{}, errors.New("visitor already rented this book")
+		}
+	}
+	if err := checkMembership(visitor); err != nil {
+		return Loan{}, err
+	}
+	if err := checkLoanLimit(visitor); err != nil {
+		return Loan{}, err
+	}
+	if err := checkBalance(visitor); err != nil {
+		return Loan{}, err
+	}
+	expireHolds()
+	if err := checkHoldsForRent(vid, bid); err != nil {
+		return Loan{}, err
+	}
+
+	// Pick the copy: the one scanned, or the first on the shelf
+	copies := bookItems(bid)
+	if barcode != "" {
+		item, exists := items[barcode]
+		if !exists || item.BookID != bid {
+			return Loan{}, errors.New("copy not found")
+		}
+		if item.Status != statusAvailable {
+			return Loan{}, fmt.Errorf("copy %s is %s", barcode, item.Status)
+		}
+	} else {
+		for _, item := range copies {
+			if item.Status == statusAvailable {
+				barcode = item.Barcode
+				break
+			}
+		}
+		if len(copies) > 0 && barcode == "" {
+			return Loan{}, errors.New("no copy is on the shelf")
+		}
+	}
+
+	loan := newLoan(visitor, bid)
+	loan.Barcode = barcode
+	visitor.RentedIDs = append(visitor.RentedIDs, bid)
+	visitor.Loans = append(visitor.Loans, loan)
+
+	// Important: Save updated visitor back to map
+	visitors[vid] = visitor
+	saveVisitors()
+	if barcode != "" {
+		item := items[barcode]
+		item.Status = statusOnLoan
+		items[barcode] = item
+		saveItems()
+	}
+	fulfillHold(vid, bid)
+	return loan, nil
+}
+
+// returnInfo is what happened when a book came back.
+type returnInfo struct {
+	Loan  Loan   // Loan is the loan that ended; zero for loans made before due dates were kept
+	Fine  int    // Fine is the late fee charged, in cents
+	Holds []Hold // Holds are the holds the returned copy is now kept for
+}
+
+// returnBookFrom removes book bid from visitor vid's rentals and saves the visitors file.
+// The copy goes back on the shelf, and a late fee is charged if it is overdue.
+func returnBookFrom(vid, bid int) (returnInfo, error) {
+	info := returnInfo{}
+	visitor, found := visitors[vid]
+	if !found {
+		return info, errors.New("visitor not found")
+	}
+
+	index := -1
+	for i, id := range visitor.RentedIDs {
+		if id == bid {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return info, errors.New("this book is not currently rented by the visitor")
+	}
+
+	// Remove the book ID from the RentedIDs slice
+	visitor.RentedIDs = append(visitor.RentedIDs[:index], visitor.RentedIDs[index+1:]...)
+	if i := findLoan(visitor, bid); i != -1 {
+		info.Loan = visitor.Loans[i]
+		info.Fine = chargeLateFine(vid, info.Loan)
+		visitor.Loans = append(visitor.Loans[:i], visitor.Loans[i+1:]...)
+	}
+	// Save the updated visitor struct back into the map
+	visitors[vid] = visitor
+	saveVisitors()
+
+	barcode := info.Loan.Barcode
+	if barcode == "" {
+		barcode = unlinkedCopy(bid) // A copy added while the book was already out
+	}
+	if item, exists := items[barcode]; exists && item.Status == statusOnLoan {
+		item.Status = statusAvailable
+		items[barcode] = item
+		saveItems()
+	}
+	// The next visitor waiting for the book gets it kept for them
+	info.Holds = promoteHolds(bid)
+	return info, nil
+}
+
+// rentBook rents one or more books to a visitor in one go: "RENT 3 12 C000004"
+// rents both, and at the menu it asks for more until Enter. RECEIPT then
+// prints a receipt for all of them.
+func rentBook(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID or card number: ")
+	if err != nil {
+		return err
+	}
+
+	if _, exists := visitors[vid]; !exists {
+		return errors.New("visitor not found")
+	}
+
+	fromArgs := p.hasArgs()
+	tx := newReceipt("rent")
+	failed := 0
+	defer func() {
+		if len(tx.Items) > 0 {
+			tx.finish(vid)
+			lastReceipt = tx
+		}
+	}()
+	for first := true; ; first = false {
+		bid, barcode, done, err := nextTransactionBook(p, "rent", first, fromArgs)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+		loan, err := rentCopy(vid, bid, barcode)
+		if err != nil {
+			if first && fromArgs && !p.hasArgs() {
+				return fmt.Errorf("could not rent book: %w", err) // The usual RENT of one book
+			}
+			fmt.Printf("Could not rent book %d: %v\n", bid, err)
+			failed++
+			continue
+		}
+		if loan.Barcode != "" {
+			fmt.Printf("Copy %s rented, due %s.\n", loan.Barcode, loan.Due.Format("2006-01-02"))
+		} else {
+			fmt.Println("Book rented, due", loan.Due.Format("2006-01-02")+".")
+		}
+		tx.Items = append(tx.Items, receiptItem{Book: books[bid], Barcode: loan.Barcode, Due: loan.Due})
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d book(s) could not be rented", failed)
+	}
+	return nil
+}
+
+// returnBook takes back one or more books from a visitor, like rentBook.
+func returnBook(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID or card number: ")
+	if err != nil {
+		return err
+	}
+
+	if _, found := visitors[vid]; !found {
+		return errors.New("visitor not found")
+	}
+
+	fromArgs := p.hasArgs()
+	tx := newReceipt("return")
+	failed := 0
+	defer func() {
+		if len(tx.Items) > 0 {
+			tx.finish(vid)
+			lastReceipt = tx
+		}
+	}()
+	for first := true; ; first = false {
+		bid, barcode, done, err := nextTransactionBook(p, "return", first, fromArgs)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+		single := first && fromArgs && !p.hasArgs() // The usual RETURN of one book
+		if i := findLoan(visitors[vid], bid); barcode != "" && (i == -1 || visitors[vid].Loans[i].Barcode != barcode) {
+			err = fmt.Errorf("copy %s is not rented by the visitor", barcode)
+		}
+		var info returnInfo
+		if err == nil {
+			info, err = returnBookFrom(vid, bid)
+		}
+		if err != nil {
+			if single {
+				return fmt.Errorf("could not return book: %w", err)
+			}
+			fmt.Printf("Could not return book %d: %v\n", bid, err)
+			failed++
+			continue
+		}
+		fmt.Println("Book returned.")
+		if info.Fine > 0 {
+			fmt.Printf("The book was late: %s charged, %s owes %s.\n", formatMoney(info.Fine), visitors[vid].Name, formatMoney(balance(vid)))
+		}
+		for _, hold := range info.Holds {
+			fmt.Printf("Keep it for %s: on hold until %s.\n", visitors[hold.VisitorID].Name, hold.PickupBy.Format("2006-01-02"))
+		}
+		tx.Items = append(tx.Items, receiptItem{Book: books[bid], Barcode: info.Loan.Barcode, Due: info.Loan.Due, Fine: info.Fine})
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d book(s) could not be returned", failed)
+	}
+	p.waitForReturn()
+	return nil
+}
+
+func handleCreate(p *prompter) error {
+	input, err := p.line("Enter ISBN (Enter to skip): ")
+	if err != nil {
+		return err
+	}
+	isbn := cleanISBN(input)
+
+	if isbn != "" {
+		meta, found, err := lookupISBN(isbn)
+		switch {
+		case err != nil:
+			fmt.Println("ISBN lookup failed:", err)
+		case !found:
+			fmt.Println("ISBN not found in local metadata, please enter the details.")
+		default:
+			printISBNMetadata(meta)
+			use, err := p.yesNo("Use these details? (y/n): ")
+			if err != nil {
+				return err
+			}
+			if use {
+				return addBook(p, Book{Title: meta.Title, Author: meta.Author, ISBN: meta.ISBN, Publisher: meta.Publisher, Year: meta.Year})
+			}
+		}
+		if !validISBN(isbn) {
+			isbn = "" // Don't store an ISBN we know is wrong
+		}
+	}
+
+	title, err := p.text("Enter title: ")
+	if err != nil {
+		return err
+	}
+
+	author, err := p.text("Enter author: ")
+	if err != nil {
+		return err
+	}
+
+	return addBook(p, Book{Title: title, Author: author, ISBN: isbn})
+}
+
+func handleUpdate(p *prompter) error {
+	id, err := p.bookID("Enter ID to update: ")
+	if err != nil {
+		return err
+	}
+	book, exists := books[id]
+	if !exists {
+		return errors.New("book not found")
+	}
+
+	changes := make(map[string]string)
+	updated := book
+	if assignments := p.takeAssignments(bookFields); len(assignments) > 0 {
+		// UPDATE 5 author="New Name" year=1999
+		for _, arg := range assignments {
+			field, value, err := parseAssignment(arg)
+			if err != nil {
+				return err
+			}
+			if err := setBookField(&updated, field, value); err != nil {
+				return err
+			}
+			changes[field] = value
+		}
+	} else {
+		fields := bookFields
+		if p.hasArgs() {
+			fields = []string{"title", "author"} // UPDATE 5 "New Title" "New Author"
+		} else {
+			printBookDetails(book)
+			fmt.Println("Press Enter to keep a value, or type - to clear it.")
+		}
+		for _, field := range fields {
+			for {
+				current := getBookField(book, field)
+				if current == "" {
+					current = "none"
+				}
+				value, err := p.line(fmt.Sprintf("%s [%s]: ", bookFieldLabels[field], current))
+				if err != nil {
+					return err
+				}
+				if value == "" {
+					break // Keep the current value
+				}
+				if value == "-" {
+					value = ""
+				}
+				if err := setBookField(&updated, field, value); err != nil {
+					p.retry("%v", err)
+					continue
+				}
+				changes[field] = value
+				break
+			}
+		}
+	}
+
+	if updated == book {
+		fmt.Println("Nothing to change.")
+		return nil
+	}
+	fmt.Println("Changes:")
+	for _, field := range bookFields {
+		if before, after := getBookField(book, field), getBookField(updated, field); before != after {
+			fmt.Printf("  %s: %q -> %q\n", bookFieldLabels[field], before, after)
+		}
+	}
+	if err := p.confirm("Update this book? (y/n): "); err != nil {
+		return err
+	}
+	return updateBook(id, changes)
+}
+
+func handleDelete(p *prompter) error {
+	id, err := p.bookID("Enter ID to delete: ")
+	if err != nil {
+		return err
+	}
+	book, exists := books[id]
+	if !exists {
+		return errors.New("book not found")
+	}
+	printBook(book)
+	for _, v := range visitors {
+		for _, bid := range v.RentedIDs {
+			if bid == id {
+				fmt.Printf("Warning: %s is renting this book.\n", v.Name)
+			}
+		}
+	}
+	if err := p.confirm("Delete this book? (y/n): "); err != nil {
+		return err
+	}
+	return deleteBook(id)
+}
+
+// handleDryRun switches dry-run mode on or off.
+func handleDryRun(p *prompter) error {
+	state, err := p.choice("Dry run (on/off): ", []string{"on", "off"})
+	if err != nil {
+		return err
+	}
+	wasOn := dryRunMode
+	dryRunMode = state == "on"
+	if dryRunMode {
+		fmt.Println("Dry run is on: changes are shown but not saved.")
+	} else if wasOn {
+		reloadData()
+		fmt.Println("Dry run is off: the changes made during it are dropped and changes are saved again.")
+	} else {
+		fmt.Println("Dry run is off: changes are saved again.")
+	}
+	return nil
+}
+
+// reloadData reads the data files again, dropping every change that was
+// made in memory but never saved, such as during a dry run.
+func reloadData() {
+	books, visitors, items = make(map[int]Book), make(map[int]Visitor), make(map[string]Item)
+	nextID, nextVisitorID = 1, 1
+	holds, ledger = nil, nil
+	loadBooks()
+	loadVisitors()
+	loadHolds()
+	loadItems()
+	loadLedger()
+	loadSentReminders()
+}
+
+const Green = "\033[32m"
+const Reset = "\033[0m"
+
+func main() {
+	useTUI := flag.Bool("tui", false, "start in the full-screen terminal UI")
+	flag.BoolVar(&dryRunMode, "dry-run", false, "show changes without saving them")
+	flag.BoolVar(&assumeYes, "yes", false, "answer yes to every confirmation")
+	now := flag.String("now", "", "pretend the program runs at this date or time (hidden)")
+	flag.Usage = printUsage
+	flag.Parse()
+	if *now != "" {
+		if err := setNow(*now); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		fmt.Println(Green + "Pretending it is " + clock.Now().Format("Monday 2006-01-02 15:04") + Reset)
+	}
+
+	loadBooks()
+	loadVisitors()
+	loadHolds()
+	loadItems()
+	loadCategories()
+	loadFeeRules()
+	loadLedger()
+	loadReminderSettings()
+	loadSentReminders()
+
+	switch flag.Arg(0) {
+	case "run":
+		os.Exit(runBatch(flag.Args()[1:]))
+	case "check":
+		os.Exit(checkMain(flag.Args()[1:]))
+	case "remind":
+		os.Exit(remindMain(flag.Args()[1:]))
+	}
+
+	p := newConsolePrompter()
+	if *useTUI {
+		if err := handleTUI(p); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+	for {
+		if dryRunMode {
+			fmt.Println(Green + "\n[DRY RUN: nothing will be saved]" + Reset)
+		}
+		fmt.Println(Green + "\nAvailable commands: \n\nVisitors Commands\n[VISITORS] [ADDVISITOR] [RENT] \n[RETURN] [RENEW] [CATEGORY] \n[HOLD] [HOLDS] [PAY] \n[WAIVE] [ACCOUNT] [CARD] \n[PROFILE] [MEMBERSHIPS] [REMIND] \n[RECEIPT] [TEMPLATES]\n\nBooks Commands\n[CREATE] [READ] [SEARCH] \n[UPDATE] [DELETE] [ADDCOPY] \n[COPIES] [MARKCOPY] [LABELS] \n[IMPORT] [EXPORT] [MARC] \n[CITE] [DEDUPE] [CHECK] \n[TUI] [DRYRUN] [HELP] \n[EXIT]\n" + Reset)
+		line, err := p.command("Enter command: ", commandNames)
+		if err != nil {
+			break
+		}
+		exit, err := runCommand(p, line)
+		if err != nil && !errors.Is(err, errCancelled) {
+			fmt.Println("Error:", err)
+		}
+		if exit {
+			return
+		}
+	}
+}
+
+// runCommand runs one line typed at the command prompt, like "RENT 3 12".
+// Arguments after the command answer its prompts in order. It reports
+// whether the user asked to exit and whether the command failed.
+func runCommand(p *prompter, line string) (exit bool, err error) {
+	args, err := splitArgs(line)
+	if err != nil {
+		return false, fmt.Errorf("could not read command: %w", err)
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	cmd := strings.ToUpper(args[0])
+	p.setArgs(args[1:])
+	defer func() {
+		if extra := p.unusedArgs(); len(extra) > 0 && err == nil {
+			fmt.Println("Ignored extra arguments:", strings.Join(extra, " "))
+		}
+	}()
+
+	switch cmd {
+	case "VISITORS":
+		err = showVisitors(p)
+
+	case "ADDVISITOR":
+		err = addVisitor(p)
+
+	case "RENT":
+		err = rentBook(p)
+
+	case "RETURN":
+		err = returnBook(p)
+
+	case "RENEW":
+		err = handleRenew(p)
+
+	case "CATEGORY":
+		err = handleCategory(p)
+
+	case "PAY":
+		err = handlePay(p)
+
+	case "WAIVE":
+		err = handleWaive(p)
+
+	case "ACCOUNT":
+		err = handleAccount(p)
+
+	case "CARD":
+		err = handleCard(p)
+
+	case "PROFILE":
+		err = handleProfile(p)
+
+	case "MEMBERSHIPS":
+		err = handleMemberships(p)
+
+	case "REMIND":
+		err = handleRemind(p)
+
+	case "RECEIPT":
+		err = handleReceipt(p)
+
+	case "TEMPLATES":
+		err = handleTemplates(p)
+
+	case "ADDCOPY":
+		err = handleAddCopy(p)
+
+	case "COPIES":
+		err = handleCopies(p)
+
+	case "MARKCOPY":
+		err = handleMarkCopy(p)
+
+	case "LABELS":
+		err = handleLabels(p)
+
+	case "HOLD":
+		err = handleHold(p)
+
+	case "HOLDS":
+		err = showHolds(p)
+
+	case "CREATE":
+		err = handleCreate(p)
+
+	case "READ":
+		readBooks()
+		p.waitForReturn()
+
+	case "SEARCH":
+		var query string
+		query, err = p.line("Enter title keyword to search: ")
+		if err != nil {
+			break
+		}
+		searchBooks(query)
+		p.waitForReturn()
+
+	case "UPDATE":
+		err = handleUpdate(p)
+
+	case "DELETE":
+		err = handleDelete(p)
+
+	case "IMPORT":
+		err = handleImport(p)
+
+	case "EXPORT":
+		err = handleExport(p)
+
+	case "MARC":
+		err = handleMARC(p)
+
+	case "CITE":
+		err = handleCite(p)
+
+	case "DEDUPE":
+		err = handleDedupe(p)
+
+	case "CHECK":
+		err = handleCheck(p)
+
+	case "TUI":
+		err = handleTUI(p)
+
+	case "DRYRUN":
+		err = handleDryRun(p)
+
+	case "HELP":
+		err = handleHelp(p)
+
+	case "EXIT":
+		fmt.Println("Goodbye!")
+		return true, nil
+
+	default:
+		err = fmt.Errorf("unknown command %q, type HELP for a list", args[0])
+	}
+	return false, err
+}
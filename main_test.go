@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDryRunChangesAreDropped(t *testing.T) {
+	testLibrary(t, testStart)
+	kept, deleted := addTestBook("Dune"), addTestBook("Beowulf")
+	saveBooks()
+	before, err := os.ReadFile(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := fakePrompter("on\noff\n")
+	if err := handleDryRun(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dryRunMode = false })
+	if err := deleteBook(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := handleDryRun(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := books[deleted]; !exists {
+		t.Fatalf("book %d deleted during the dry run is still gone", deleted)
+	}
+
+	// A real save afterwards writes the books as they were
+	saveBooks()
+	after, err := os.ReadFile(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("%s changed after a dry-run DELETE of book %d:\nbefore %s\nafter %s", dataFile, deleted, before, after)
+	}
+	if books[kept].Title != "Dune" {
+		t.Errorf("book %d = %+v after the reload", kept, books[kept])
+	}
+}
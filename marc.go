@@ -0,0 +1,481 @@
+package main
+
+/*
+	MARC21 is the record format libraries use to exchange catalog data.
+	A record is a list of numbered fields ("tags"). Control fields (001-009) hold
+	a single value; data fields have two indicator characters and a list of
+	subfields, each identified by a single letter code.
+
+	We only map the fields a Book has:
+		001     control number (our book ID on export)
+		020 $a  ISBN
+		100 $a  main author
+		245 $a  title ($b subtitle is appended on import)
+		264 $b  publisher, $c year (260 is also read on import)
+
+	The binary format (ISO 2709) is a 24 byte leader, a directory of
+	12 byte entries (tag, length, start) and then the field data.
+	MARCXML is the same record written as XML.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	marcSubfieldDelimiter = 0x1F // marcSubfieldDelimiter starts every subfield
+	marcFieldTerminator   = 0x1E // marcFieldTerminator ends every field and the directory
+	marcRecordTerminator  = 0x1D // marcRecordTerminator ends a record
+	marcLeaderLength      = 24
+	marcDirEntryLength    = 12
+	marcXMLNamespace      = "http://www.loc.gov/MARC21/slim"
+)
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+// marcRecord is one MARC record. The struct tags let encoding/xml read and write MARCXML directly.
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcCollection struct {
+	XMLName xml.Name     `xml:"collection"`
+	Xmlns   string       `xml:"xmlns,attr,omitempty"`
+	Records []marcRecord `xml:"record"`
+}
+
+// subfield returns the first value of code in the first field with tag, or "".
+func (r marcRecord) subfield(tag, code string) string {
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, sf := range field.Subfields {
+			if sf.Code == code {
+				return sf.Value
+			}
+		}
+	}
+	return ""
+}
+
+// isbdPunctuation matches the trailing punctuation catalogers put at the end of subfields, like " /" or " :".
+var isbdPunctuation = regexp.MustCompile(`[\s/:;,=.]+$`)
+
+// yearPattern finds the first four digit year in a date like "March 1965"
+// or a 264/260 $c value like "c1965." or "[1999?]".
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+func cleanMARCValue(value string) string {
+	return strings.TrimSpace(isbdPunctuation.ReplaceAllString(strings.TrimSpace(value), ""))
+}
+
+// marcToBook converts a record to a book. The ID is left at 0; the caller assigns it.
+func marcToBook(r marcRecord) Book {
+	book := Book{}
+
+	book.Title = cleanMARCValue(r.subfield("245", "a"))
+	if subtitle := cleanMARCValue(r.subfield("245", "b")); subtitle != "" {
+		book.Title += ": " + subtitle
+	}
+	book.Author = cleanMARCValue(r.subfield("100", "a"))
+
+	// 020 $a may hold qualifiers after the number, e.g. "9780441013593 (pbk.)"
+	if isbn := strings.Fields(r.subfield("020", "a")); len(isbn) > 0 {
+		book.ISBN = isbn[0]
+	}
+
+	for _, tag := range []string{"264", "260"} {
+		if book.Publisher == "" {
+			book.Publisher = cleanMARCValue(r.subfield(tag, "b"))
+		}
+		if book.Year == 0 {
+			if year := yearPattern.FindString(r.subfield(tag, "c")); year != "" {
+				book.Year, _ = strconv.Atoi(year)
+			}
+		}
+	}
+	return book
+}
+
+// bookToMARC converts a book to a record with the fields listed at the top of this file.
+func bookToMARC(book Book) marcRecord {
+	r := marcRecord{
+		Leader:        "00000nam a2200000 i 4500", // Lengths are filled in when the binary record is written
+		ControlFields: []marcControlField{{Tag: "001", Value: strconv.Itoa(book.ID)}},
+	}
+	if book.ISBN != "" {
+		r.DataFields = append(r.DataFields, marcDataField{Tag: "020", Ind1: " ", Ind2: " ",
+			Subfields: []marcSubfield{{Code: "a", Value: book.ISBN}}})
+	}
+	if book.Author != "" {
+		r.DataFields = append(r.DataFields, marcDataField{Tag: "100", Ind1: "1", Ind2: " ",
+			Subfields: []marcSubfield{{Code: "a", Value: book.Author}}})
+	}
+	titleInd1 := "0" // First indicator 0 means no title added entry, used when there is no author
+	if book.Author != "" {
+		titleInd1 = "1"
+	}
+	r.DataFields = append(r.DataFields, marcDataField{Tag: "245", Ind1: titleInd1, Ind2: "0",
+		Subfields: []marcSubfield{{Code: "a", Value: book.Title}}})
+	if book.Publisher != "" || book.Year != 0 {
+		field := marcDataField{Tag: "264", Ind1: " ", Ind2: "1"}
+		if book.Publisher != "" {
+			field.Subfields = append(field.Subfields, marcSubfield{Code: "b", Value: book.Publisher})
+		}
+		if book.Year != 0 {
+			field.Subfields = append(field.Subfields, marcSubfield{Code: "c", Value: strconv.Itoa(book.Year)})
+		}
+		r.DataFields = append(r.DataFields, field)
+	}
+	return r
+}
+
+// encodeMARC writes r in MARC21 binary (ISO 2709) form.
+func encodeMARC(r marcRecord) ([]byte, error) {
+	var directory, data bytes.Buffer
+
+	addField := func(tag string, body []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+		body = append(body, marcFieldTerminator)
+		if len(body) > 9999 {
+			return fmt.Errorf("field %s is too long", tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(body), data.Len())
+		data.Write(body)
+		return nil
+	}
+
+	for _, field := range r.ControlFields {
+		if err := addField(field.Tag, []byte(field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range r.DataFields {
+		body := []byte(marcIndicator(field.Ind1) + marcIndicator(field.Ind2))
+		for _, sf := range field.Subfields {
+			body = append(body, marcSubfieldDelimiter)
+			body = append(body, sf.Code...)
+			body = append(body, sf.Value...)
+		}
+		if err := addField(field.Tag, body); err != nil {
+			return nil, err
+		}
+	}
+	directory.WriteByte(marcFieldTerminator)
+
+	baseAddress := marcLeaderLength + directory.Len()
+	length := baseAddress + data.Len() + 1
+	if length > 99999 {
+		return nil, errors.New("record is too long")
+	}
+
+	leader := []byte(r.Leader)
+	if len(leader) != marcLeaderLength {
+		leader = []byte("00000nam a2200000 i 4500")
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	leader[9] = 'a' // Character coding: UTF-8
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, data.Bytes()...)
+	out = append(out, marcRecordTerminator)
+	return out, nil
+}
+
+// marcIndicator returns a blank for an empty indicator so the field layout stays fixed.
+func marcIndicator(ind string) string {
+	if ind == "" {
+		return " "
+	}
+	return ind[:1]
+}
+
+// marcNumber reads a fixed-width number from the leader or directory. Unlike
+// strconv.Atoi it allows only digits, so a sign can't sneak in.
+func marcNumber(field []byte) (int, bool) {
+	if len(field) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range field {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// decodeMARC parses one MARC21 binary record.
+func decodeMARC(raw []byte) (marcRecord, error) {
+	if len(raw) < marcLeaderLength+1 {
+		return marcRecord{}, errors.New("record is shorter than the leader")
+	}
+	r := marcRecord{Leader: string(raw[:marcLeaderLength])}
+
+	baseAddress, ok := marcNumber(raw[12:17])
+	if !ok || baseAddress <= marcLeaderLength || baseAddress > len(raw) {
+		return marcRecord{}, fmt.Errorf("invalid base address %q", raw[12:17])
+	}
+
+	directory := raw[marcLeaderLength : baseAddress-1] // The directory ends with a field terminator
+	if len(directory)%marcDirEntryLength != 0 {
+		return marcRecord{}, errors.New("directory length is not a multiple of 12")
+	}
+	for i := 0; i < len(directory); i += marcDirEntryLength {
+		entry := directory[i : i+marcDirEntryLength]
+		tag := string(entry[0:3])
+		length, ok1 := marcNumber(entry[3:7])
+		start, ok2 := marcNumber(entry[7:12])
+		if _, ok3 := marcNumber(entry[0:3]); !ok1 || !ok2 || !ok3 {
+			return marcRecord{}, fmt.Errorf("invalid directory entry %q", entry)
+		}
+		begin, end := baseAddress+start, baseAddress+start+length
+		if length < 1 || start < 0 || begin < baseAddress || end > len(raw) {
+			return marcRecord{}, fmt.Errorf("field %s points outside the record", tag)
+		}
+		body := raw[begin : end-1] // Drop the field terminator
+
+		if strings.HasPrefix(tag, "00") {
+			r.ControlFields = append(r.ControlFields, marcControlField{Tag: tag, Value: string(body)})
+			continue
+		}
+		if len(body) < 2 {
+			return marcRecord{}, fmt.Errorf("field %s is missing indicators", tag)
+		}
+		field := marcDataField{Tag: tag, Ind1: string(body[0]), Ind2: string(body[1])}
+		for _, part := range bytes.Split(body[2:], []byte{marcSubfieldDelimiter}) {
+			if len(part) == 0 {
+				continue // Text before the first delimiter is empty
+			}
+			field.Subfields = append(field.Subfields, marcSubfield{Code: string(part[0]), Value: string(part[1:])})
+		}
+		r.DataFields = append(r.DataFields, field)
+	}
+	return r, nil
+}
+
+// splitMARCRecords is a bufio.SplitFunc that yields one binary record at a time.
+func splitMARCRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Skip newlines some tools put between records
+	start := 0
+	for start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+	if i := bytes.IndexByte(data[start:], marcRecordTerminator); i >= 0 {
+		return start + i + 1, data[start : start+i+1], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil // Trailing data without a terminator, decodeMARC will report it
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
+
+// readMARCRecords reads all binary records from r. A record that fails to parse
+// is returned as an error entry so the caller can report it and carry on.
+func readMARCRecords(r io.Reader) ([]marcRecord, []error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 100000) // A record is at most 99999 bytes
+	scanner.Split(splitMARCRecords)
+
+	records := []marcRecord{}
+	problems := []error{}
+	n := 0
+	for scanner.Scan() {
+		n++
+		record, err := decodeMARC(scanner.Bytes())
+		if err != nil {
+			problems = append(problems, fmt.Errorf("record %d: %w", n, err))
+			records = append(records, marcRecord{}) // Keep record numbers aligned with the file
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, err)
+	}
+	return records, problems
+}
+
+// readMARCXML reads a MARCXML <collection> or a single <record>.
+func readMARCXML(r io.Reader) ([]marcRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var collection marcCollection
+	if err := xml.Unmarshal(data, &collection); err == nil {
+		return collection.Records, nil
+	}
+	var record marcRecord
+	if err := xml.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("reading MARCXML: %w", err)
+	}
+	return []marcRecord{record}, nil
+}
+
+func writeMARCXML(w io.Writer, records []marcRecord) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(marcCollection{Xmlns: marcXMLNamespace, Records: records}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// isMARCXMLPath reports whether path should be treated as MARCXML rather than binary MARC.
+func isMARCXMLPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xml")
+}
+
+// importMARC reads records from path and adds them through the same validation as IMPORT.
+func importMARC(path string, dryRun bool) (importReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return importReport{}, err
+	}
+	defer file.Close()
+
+	var records []marcRecord
+	var problems []error
+	if isMARCXMLPath(path) {
+		records, err = readMARCXML(file)
+		if err != nil {
+			return importReport{}, err
+		}
+	} else {
+		records, problems = readMARCRecords(file)
+	}
+
+	rows := []importRow{}
+	for i, record := range records {
+		if record.Leader == "" && len(record.DataFields) == 0 {
+			continue // Failed to parse, already in problems
+		}
+		book := marcToBook(record)
+		row := importRow{Line: i + 1, Title: book.Title, Author: book.Author, ISBN: book.ISBN, Publisher: book.Publisher}
+		if book.Year != 0 {
+			row.Year = strconv.Itoa(book.Year)
+		}
+		rows = append(rows, row)
+	}
+
+	report := importBooks(rows, dryRun)
+	for _, problem := range problems {
+		report.Skipped++
+		report.Errors = append(report.Errors, problem.Error())
+	}
+	return report, nil
+}
+
+// exportMARC writes the books whose title matches query to path.
+func exportMARC(path, query string) (int, error) {
+	records := []marcRecord{}
+	for _, id := range sortedBookIDs() {
+		if book := books[id]; matchesQuery(book.Title, query) {
+			records = append(records, bookToMARC(book))
+		}
+	}
+
+	var out bytes.Buffer
+	if isMARCXMLPath(path) {
+		if err := writeMARCXML(&out, records); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, record := range records {
+			raw, err := encodeMARC(record)
+			if err != nil {
+				return 0, fmt.Errorf("book %s: %w", record.ControlFields[0].Value, err)
+			}
+			out.Write(raw)
+		}
+	}
+	return len(records), os.WriteFile(path, out.Bytes(), 0644)
+}
+
+func handleMARC(p *prompter) error {
+	action, err := p.choice("Import or export? (import/export): ", []string{"import", "export"})
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "import":
+		path, err := p.text("Enter MARC file (.mrc for MARC21, .xml for MARCXML): ")
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := p.yesNo("Dry run? (y/n): ")
+		if err != nil {
+			return err
+		}
+
+		report, err := importMARC(path, dryRun)
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", path, err)
+		}
+		printImportReport(report, dryRun)
+
+	case "export":
+		path, err := p.text("Output file (.mrc for MARC21, .xml for MARCXML): ")
+		if err != nil {
+			return err
+		}
+
+		query, err := p.line("Filter keyword (Enter for all): ")
+		if err != nil {
+			return err
+		}
+
+		n, err := exportMARC(path, query)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", path, err)
+		}
+		fmt.Printf("Exported %d record(s) to %s\n", n, path)
+	}
+	p.waitForReturn()
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// sampleBooks cover a full record, a book without author or publisher and
+// text outside ASCII.
+var sampleBooks = []Book{
+	{ID: 1, Title: "Dune", Author: "Herbert, Frank", ISBN: "9780441013593", Publisher: "Ace Books", Year: 1965},
+	{ID: 2, Title: "Beowulf"},
+	{ID: 3, Title: "Œuvres complètes: tome 1", Author: "Molière", Year: 1682},
+}
+
+// withoutID returns book as marcToBook returns it, which leaves the ID to the caller.
+func withoutID(book Book) Book {
+	book.ID = 0
+	return book
+}
+
+func TestMARCBinaryRoundTrip(t *testing.T) {
+	for _, book := range sampleBooks {
+		raw, err := encodeMARC(bookToMARC(book))
+		if err != nil {
+			t.Fatalf("encoding %q: %v", book.Title, err)
+		}
+		record, err := decodeMARC(raw)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", book.Title, err)
+		}
+		if got := marcToBook(record); got != withoutID(book) {
+			t.Errorf("round trip of %q gave %+v", book.Title, got)
+		}
+	}
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	records := []marcRecord{}
+	for _, book := range sampleBooks {
+		records = append(records, bookToMARC(book))
+	}
+	var out bytes.Buffer
+	if err := writeMARCXML(&out, records); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readMARCXML(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(sampleBooks) {
+		t.Fatalf("read %d records, want %d", len(read), len(sampleBooks))
+	}
+	for i, book := range sampleBooks {
+		if got := marcToBook(read[i]); got != withoutID(book) {
+			t.Errorf("round trip of %q gave %+v", book.Title, got)
+		}
+	}
+}
+
+func TestMARCXMLSingleRecord(t *testing.T) {
+	const single = `<record><datafield tag="245" ind1="0" ind2="0"><subfield code="a">Beowulf /</subfield></datafield></record>`
+	read, err := readMARCXML(strings.NewReader(single))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || marcToBook(read[0]).Title != "Beowulf" {
+		t.Errorf("got %+v", read)
+	}
+}
+
+func TestMARCXMLMalformed(t *testing.T) {
+	if _, err := readMARCXML(strings.NewReader("<collection><record>")); err == nil {
+		t.Error("expected an error for truncated MARCXML")
+	}
+}
+
+// corrupt returns a copy of the encoded record for book with data written at offset.
+func corrupt(t *testing.T, book Book, offset int, data string) []byte {
+	t.Helper()
+	raw, err := encodeMARC(bookToMARC(book))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(raw[offset:], data)
+	return raw
+}
+
+func TestDecodeMARCMalformed(t *testing.T) {
+	// The first directory entry starts right after the leader: 3 bytes of
+	// tag, 4 of length and 5 of start.
+	const entry = marcLeaderLength
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"too short", []byte("00000nam")},
+		{"base address not a number", corrupt(t, sampleBooks[0], 12, "ab123")},
+		{"signed base address", corrupt(t, sampleBooks[0], 12, "-0001")},
+		{"tag not a number", corrupt(t, sampleBooks[0], entry, "0x1")},
+		{"signed length", corrupt(t, sampleBooks[0], entry+3, "+004")},
+		{"negative start", corrupt(t, sampleBooks[0], entry+7, "-9999")},
+		{"start past the end", corrupt(t, sampleBooks[0], entry+7, "99999")},
+		{"zero length", corrupt(t, sampleBooks[0], entry+3, "0000")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := decodeMARC(test.raw); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadMARCRecordsSkipsMalformed(t *testing.T) {
+	var file bytes.Buffer
+	good, err := encodeMARC(bookToMARC(sampleBooks[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(good)
+	file.Write(corrupt(t, sampleBooks[1], marcLeaderLength+7, "-9999"))
+	file.Write(good)
+
+	records, problems := readMARCRecords(&file)
+	if len(records) != 3 {
+		t.Fatalf("read %d records, want 3", len(records))
+	}
+	if len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), "record 2:") {
+		t.Errorf("problems = %v, want one for record 2", problems)
+	}
+	if marcToBook(records[2]).Title != "Dune" {
+		t.Errorf("the record after the malformed one was not read: %+v", records[2])
+	}
+}
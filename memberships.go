@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const membershipMonths = 12 // membershipMonths is how long a new membership lasts
+
+// expiringSoonDays is how far ahead MEMBERSHIPS looks when no number of days is given.
+const expiringSoonDays = 30
+
+// startOfDay returns midnight at the start of t's day.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// newMembership sets the joined and expiry dates of a visitor joining today.
+func newMembership(v *Visitor) {
+	v.Joined = startOfDay(clock.Now())
+	v.Expires = v.Joined.AddDate(0, membershipMonths, 0)
+}
+
+// membershipExpired reports whether v's membership ended before today. The
+// expiry day itself still counts. Visitors without an expiry date, such as
+// those added before memberships were kept, never expire.
+func membershipExpired(v Visitor, now time.Time) bool {
+	return !v.Expires.IsZero() && startOfDay(now).After(v.Expires)
+}
+
+// membershipStatus describes v's membership, e.g. "member until 2027-10-15".
+func membershipStatus(v Visitor) string {
+	switch {
+	case v.Expires.IsZero():
+		return "membership doesn't expire"
+	case membershipExpired(v, clock.Now()):
+		return "membership expired on " + formatDate(v.Expires)
+	}
+	return "member until " + formatDate(v.Expires)
+}
+
+// checkMembership returns an error when v's membership has expired.
+func checkMembership(v Visitor) error {
+	if membershipExpired(v, clock.Now()) {
+		return fmt.Errorf("%s's membership expired on %s; extend it with PROFILE %d expires=YYYY-MM-DD", v.Name, formatDate(v.Expires), v.ID)
+	}
+	return nil
+}
+
+// expiringMemberships returns the visitors whose membership ends within days
+// from today, or has already ended, soonest first.
+func expiringMemberships(days int) []Visitor {
+	limit := startOfDay(clock.Now()).AddDate(0, 0, days)
+	expiring := []Visitor{}
+	for _, id := range sortedVisitorIDs() {
+		v := visitors[id]
+		if !v.Expires.IsZero() && !v.Expires.After(limit) {
+			expiring = append(expiring, v)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].Expires.Before(expiring[j].Expires) })
+	return expiring
+}
+
+// handleMemberships lists memberships that have expired or expire soon.
+func handleMemberships(p *prompter) error {
+	answer, err := p.line(fmt.Sprintf("Expiring within how many days? (Enter for %d): ", expiringSoonDays))
+	if err != nil {
+		return err
+	}
+	days := expiringSoonDays
+	if answer != "" {
+		if days, err = strconv.Atoi(answer); err != nil || days < 0 {
+			return errors.New("the number of days must be a whole number, 0 or more")
+		}
+	}
+
+	expiring := expiringMemberships(days)
+	if len(expiring) == 0 {
+		fmt.Printf("No memberships expire within %d day(s).\n", days)
+		p.waitForReturn()
+		return nil
+	}
+	for _, v := range expiring {
+		contact := v.Email
+		if contact == "" {
+			contact = v.Phone
+		}
+		fmt.Printf("ID: %d, Name: %s, Contact: %s, %s\n", v.ID, v.Name, orNone(contact), membershipStatus(v))
+	}
+	p.waitForReturn()
+	return nil
+}
+
+// handleProfile shows a visitor's profile and changes the fields given, the
+// same way UPDATE does for books.
+func handleProfile(p *prompter) error {
+	vid, err := p.visitorID("Visitor ID or card number: ")
+	if err != nil {
+		return err
+	}
+	visitor, exists := visitors[vid]
+	if !exists {
+		return errors.New("visitor not found")
+	}
+
+	updated := visitor
+	if assignments := p.takeAssignments(visitorFields); len(assignments) > 0 {
+		// PROFILE 3 email=ada@example.com expires=2027-10-15
+		for _, arg := range assignments {
+			field, value, err := parseAssignment(arg)
+			if err != nil {
+				return err
+			}
+			if err := setVisitorField(&updated, field, value); err != nil {
+				return err
+			}
+		}
+	} else {
+		printVisitorDetails(visitor)
+		fmt.Println("Press Enter to keep a value, or type - to clear it.")
+		for _, field := range visitorFields {
+			for {
+				value, err := p.line(fmt.Sprintf("%s [%s]: ", visitorFieldLabels[field], orNone(getVisitorField(updated, field))))
+				if err != nil {
+					return err
+				}
+				if value == "" {
+					break // Keep the current value
+				}
+				if value == "-" {
+					value = ""
+				}
+				if err := setVisitorField(&updated, field, value); err != nil {
+					p.retry("%v", err)
+					continue
+				}
+				break
+			}
+		}
+	}
+
+	changed := false
+	for _, field := range visitorFields {
+		if before, after := getVisitorField(visitor, field), getVisitorField(updated, field); before != after {
+			if !changed {
+				fmt.Println("Changes:")
+				changed = true
+			}
+			fmt.Printf("  %s: %q -> %q\n", visitorFieldLabels[field], before, after)
+		}
+	}
+	if !changed {
+		fmt.Println("Nothing to change.")
+		return nil
+	}
+	if err := p.confirm("Update this visitor? (y/n): "); err != nil {
+		return err
+	}
+	visitors[vid] = updated
+	saveVisitors()
+	fmt.Println("Visitor updated.")
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errCancelled is returned by the prompts when the user types "cancel" or input ends.
+// Commands pass it up unchanged; the menu doesn't report it as a failure.
+var errCancelled = errors.New("cancelled")
+
+// cancelWord is what the user types at any prompt to abandon the current command.
+const cancelWord = "cancel"
+
+// lineRequest describes one line the prompter wants from the user.
+type lineRequest struct {
+	label       string   // label is the question shown before the cursor
+	completions []string // completions are offered when the line source supports Tab completion
+	command     bool     // command is true for the main command prompt, whose lines are kept in the history file
+}
+
+// prompter asks the user for typed values. Every command reads its input
+// through one prompter, so the console and tests can plug in any line source.
+type prompter struct {
+	readLine func(req lineRequest) (string, error) // readLine shows req.label and returns the next line without its newline, or io.EOF
+	out      io.Writer                             // out is where re-prompt hints are printed
+	pending  []string                              // pending are arguments typed after the command, used as the next answers
+	fromArgs bool                                  // fromArgs is true when the last answer was a queued argument
+}
+
+// newPrompter reads lines from in and writes prompts to out.
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	scanner := bufio.NewScanner(in)
+	return &prompter{
+		readLine: func(req lineRequest) (string, error) {
+			fmt.Fprint(out, req.label)
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		},
+		out: out,
+	}
+}
+
+// next prints label and returns the raw line the user typed.
+func (p *prompter) next(label string) (string, error) {
+	return p.readLine(lineRequest{label: label})
+}
+
+// command reads a line at the main command prompt, completing command names.
+func (p *prompter) command(label string, names []string) (string, error) {
+	return p.readLine(lineRequest{label: label, completions: names, command: true})
+}
+
+// line prints label and returns the trimmed answer, which may be empty.
+// It returns errCancelled if the user types "cancel" or input ends.
+func (p *prompter) line(label string) (string, error) {
+	return p.ask(lineRequest{label: label})
+}
+
+// setArgs queues answers for the next prompts, so "RENT 3 12" needs no questions.
+func (p *prompter) setArgs(args []string) {
+	p.pending = args
+}
+
+// unusedArgs returns the queued answers no prompt asked for, and clears the queue.
+func (p *prompter) unusedArgs() []string {
+	args := p.pending
+	p.pending = nil
+	return args
+}
+
+// hasArgs reports whether queued arguments are left.
+func (p *prompter) hasArgs() bool {
+	return len(p.pending) > 0
+}
+
+// takeAssignments removes the queued arguments written as field=value, like
+// author="New Name", and returns them. Only names in fields count, so a
+// value such as "E=mc2" stays queued with the other arguments.
+func (p *prompter) takeAssignments(fields []string) []string {
+	assignments := []string{}
+	rest := []string{}
+	for _, arg := range p.pending {
+		if name, _, found := strings.Cut(arg, "="); found && slices.Contains(fields, strings.ToLower(strings.TrimSpace(name))) {
+			assignments = append(assignments, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	p.pending = rest
+	return assignments
+}
+
+// ask reads one answer for req, handling "cancel" and end of input.
+// A queued argument is used instead of asking; if it turns out to be
+// invalid, retry drops the rest of the queue and the caller's loop asks
+// again interactively.
+func (p *prompter) ask(req lineRequest) (string, error) {
+	var text string
+	var err error
+	p.fromArgs = len(p.pending) > 0
+	if p.fromArgs {
+		text, p.pending = p.pending[0], p.pending[1:]
+	} else {
+		text, err = p.readLine(req)
+	}
+	if errors.Is(err, io.EOF) {
+		return "", errCancelled
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, cancelWord) {
+		fmt.Fprintln(p.out, "Cancelled.")
+		return "", errCancelled
+	}
+	return text, nil
+}
+
+// retry explains why the last answer was rejected, before the caller asks
+// again. When that answer was an argument on the command line, the ones
+// after it were meant for later questions, so they are dropped rather than
+// taken as the new answer. In a script the command then fails.
+func (p *prompter) retry(format string, a ...any) {
+	fmt.Fprintf(p.out, format+" (type %q to give up).\n", append(a, cancelWord)...)
+	p.dropArgs()
+}
+
+// dropArgs clears the queue if the last answer came from it.
+func (p *prompter) dropArgs() {
+	if p.fromArgs && len(p.pending) > 0 {
+		fmt.Fprintf(p.out, "Ignoring the rest of the arguments: %s\n", strings.Join(p.pending, " "))
+		p.pending = nil
+	}
+}
+
+// text asks until the user gives a non-empty answer.
+func (p *prompter) text(label string) (string, error) {
+	for {
+		text, err := p.line(label)
+		if err != nil || text != "" {
+			return text, err
+		}
+		p.retry("A value is required")
+	}
+}
+
+// int asks until the user gives a whole number.
+func (p *prompter) int(label string) (int, error) {
+	for {
+		text, err := p.line(label)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(text)
+		if err == nil {
+			return n, nil
+		}
+		p.retry("%q is not a whole number", text)
+	}
+}
+
+// yesNo asks until the user answers y, yes, n or no.
+func (p *prompter) yesNo(label string) (bool, error) {
+	for {
+		text, err := p.line(label)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(text) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		p.retry("Please answer y or n")
+	}
+}
+
+// confirm asks a yes/no question before a destructive change. It returns
+// errCancelled unless the answer is yes. With -yes it doesn't ask at all.
+func (p *prompter) confirm(label string) error {
+	if assumeYes {
+		return nil
+	}
+	yes, err := p.yesNo(label)
+	if err != nil {
+		return err
+	}
+	if !yes {
+		fmt.Fprintln(p.out, "Cancelled.")
+		return errCancelled
+	}
+	return nil
+}
+
+// choice asks until the user types one of options (ignoring case) and returns that option.
+func (p *prompter) choice(label string, options []string) (string, error) {
+	for {
+		text, err := p.line(label)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if strings.EqualFold(text, option) {
+				return option, nil
+			}
+		}
+		p.retry("Please choose one of %s", strings.Join(options, ", "))
+	}
+}
+
+// bookID asks for a book, accepting its ID or (part of) its title.
+func (p *prompter) bookID(label string) (int, error) {
+	names := make(map[int]string)
+	for id, book := range books {
+		names[id] = book.Title
+	}
+	return p.id(label, names)
+}
+
+// visitorID asks for a visitor, accepting their ID, card number or (part of) their name.
+func (p *prompter) visitorID(label string) (int, error) {
+	names := make(map[int]string)
+	for id, v := range visitors {
+		names[id] = v.Name
+	}
+	return p.idOr(label, names, visitorByCard)
+}
+
+// id asks until the answer is a number or matches exactly one of names.
+// An exact (case-insensitive) name wins over names that only contain the answer.
+func (p *prompter) id(label string, names map[int]string) (int, error) {
+	return p.idOr(label, names, nil)
+}
+
+// idOr is id with another way of naming things, such as a barcode. lookup,
+// if not nil, is tried first and returns the ID the answer stands for.
+func (p *prompter) idOr(label string, names map[int]string, lookup func(text string) (int, bool)) (int, error) {
+	completions := make([]string, 0, len(names))
+	for _, name := range names {
+		completions = append(completions, name)
+	}
+	sort.Strings(completions)
+
+	for {
+		text, err := p.ask(lineRequest{label: label, completions: completions})
+		if err != nil {
+			return 0, err
+		}
+		if text == "" {
+			p.retry("A value is required")
+			continue
+		}
+		if lookup != nil {
+			if id, found := lookup(text); found {
+				return id, nil
+			}
+		}
+		if n, err := strconv.Atoi(text); err == nil {
+			return n, nil
+		}
+
+		exact, partial := []int{}, []int{}
+		for id, name := range names {
+			if strings.EqualFold(name, text) {
+				exact = append(exact, id)
+			} else if matchesQuery(name, text) {
+				partial = append(partial, id)
+			}
+		}
+		matches := exact
+		if len(matches) == 0 {
+			matches = partial
+		}
+		switch len(matches) {
+		case 0:
+			p.retry("Nothing matches %q", text)
+		case 1:
+			return matches[0], nil
+		default:
+			sort.Ints(matches)
+			fmt.Fprintln(p.out, "More than one match, please enter the ID:")
+			for i, id := range matches {
+				if i == 10 {
+					fmt.Fprintf(p.out, "  ... and %d more\n", len(matches)-i)
+					break
+				}
+				fmt.Fprintf(p.out, "  %d  %s\n", id, names[id])
+			}
+			p.dropArgs()
+		}
+	}
+}
+
+// waitForReturn pauses until the user presses Enter on an empty line.
+func (p *prompter) waitForReturn() {
+	for {
+		text, err := p.next("\npress Enter to return: ")
+		if err != nil || text == "" {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakePrompter returns a prompter that reads input and records what it prints.
+func fakePrompter(input string) (*prompter, *strings.Builder) {
+	out := &strings.Builder{}
+	return newPrompter(strings.NewReader(input), out), out
+}
+
+func TestPrompterIntReprompts(t *testing.T) {
+	p, out := fakePrompter("abc\n\n 42 \n")
+	n, err := p.int("Number: ")
+	if err != nil || n != 42 {
+		t.Fatalf("int() = %d, %v; want 42", n, err)
+	}
+	if got := strings.Count(out.String(), "Number: "); got != 3 {
+		t.Errorf("asked %d times, want 3:\n%s", got, out)
+	}
+	if !strings.Contains(out.String(), `"abc" is not a whole number`) {
+		t.Errorf("no hint for the bad answer:\n%s", out)
+	}
+}
+
+func TestPrompterTextReprompts(t *testing.T) {
+	p, out := fakePrompter("\n   \nDune\n")
+	text, err := p.text("Title: ")
+	if err != nil || text != "Dune" {
+		t.Fatalf("text() = %q, %v; want Dune", text, err)
+	}
+	if got := strings.Count(out.String(), "A value is required"); got != 2 {
+		t.Errorf("got %d hints, want 2:\n%s", got, out)
+	}
+}
+
+func TestPrompterYesNo(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"maybe\nn\n", false},
+		{"\nno\n", false},
+	}
+	for _, test := range tests {
+		p, _ := fakePrompter(test.input)
+		got, err := p.yesNo("Sure? ")
+		if err != nil || got != test.want {
+			t.Errorf("yesNo(%q) = %v, %v; want %v", test.input, got, err, test.want)
+		}
+	}
+}
+
+func TestPrompterChoice(t *testing.T) {
+	p, out := fakePrompter("magazines\nVISITORS\n")
+	got, err := p.choice("Which? ", []string{"books", "visitors"})
+	if err != nil || got != "visitors" {
+		t.Fatalf("choice() = %q, %v; want visitors", got, err)
+	}
+	if !strings.Contains(out.String(), "Please choose one of books, visitors") {
+		t.Errorf("no hint for the bad answer:\n%s", out)
+	}
+}
+
+func TestPrompterCancel(t *testing.T) {
+	p, out := fakePrompter("x\nCancel\n42\n")
+	if _, err := p.int("Number: "); !errors.Is(err, errCancelled) {
+		t.Fatalf("int() error = %v, want errCancelled", err)
+	}
+	if !strings.Contains(out.String(), "Cancelled.") {
+		t.Errorf("cancelling printed nothing:\n%s", out)
+	}
+	// The line after "cancel" is left for the next prompt
+	if n, err := p.int("Number: "); err != nil || n != 42 {
+		t.Errorf("next int() = %d, %v; want 42", n, err)
+	}
+}
+
+func TestPrompterEOF(t *testing.T) {
+	p, _ := fakePrompter("not a number\n")
+	if _, err := p.int("Number: "); !errors.Is(err, errCancelled) {
+		t.Errorf("int() at end of input: error = %v, want errCancelled", err)
+	}
+	p, _ = fakePrompter("")
+	if _, err := p.text("Title: "); !errors.Is(err, errCancelled) {
+		t.Errorf("text() on empty input: error = %v, want errCancelled", err)
+	}
+	p, _ = fakePrompter("maybe")
+	if _, err := p.yesNo("Sure? "); !errors.Is(err, errCancelled) {
+		t.Errorf("yesNo() at end of input: error = %v, want errCancelled", err)
+	}
+}
+
+func TestPrompterArgs(t *testing.T) {
+	p, out := fakePrompter("7\n")
+	p.setArgs([]string{"3", "4"})
+	if n, err := p.int("Number: "); err != nil || n != 3 {
+		t.Fatalf("int() = %d, %v; want 3", n, err)
+	}
+	if strings.Contains(out.String(), "Number: ") {
+		t.Errorf("asked although arguments were queued:\n%s", out)
+	}
+	if !p.hasArgs() {
+		t.Fatal("the second argument was not left queued")
+	}
+
+	// A bad argument drops the rest, which were meant for later questions,
+	// and the answer is asked for instead
+	p, out = fakePrompter("7\ny\n")
+	p.setArgs([]string{"five", "3"})
+	if n, err := p.int("Number: "); err != nil || n != 7 {
+		t.Fatalf("int() = %d, %v; want 7 from the reader", n, err)
+	}
+	if !strings.Contains(out.String(), `"five" is not a whole number`) || !strings.Contains(out.String(), "Number: ") {
+		t.Errorf("the bad argument was not reported and asked again:\n%s", out)
+	}
+	if p.hasArgs() {
+		t.Errorf("arguments left after a bad one: %q", p.unusedArgs())
+	}
+	if yes, err := p.yesNo("Sure? "); err != nil || !yes {
+		t.Errorf("yesNo() = %v, %v; want yes from the reader", yes, err)
+	}
+}
+
+func TestBatchPrompterFailsOnBadArgument(t *testing.T) {
+	p := newBatchPrompter()
+	p.out = &strings.Builder{}
+	p.setArgs([]string{"Dnue", "y"})
+	if _, err := p.id("Book ID: ", map[int]string{1: "Dune"}); err == nil || errors.Is(err, errCancelled) {
+		t.Errorf("id() error = %v, want a missing argument", err)
+	}
+}
+
+func TestPrompterTakeAssignments(t *testing.T) {
+	p, _ := fakePrompter("")
+	p.setArgs([]string{"E=mc2", "Author=Einstein", "year = 1916", "notes=x"})
+	got := p.takeAssignments(bookFields)
+	if want := []string{"Author=Einstein", "year = 1916"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("assignments = %q, want %q", got, want)
+	}
+	if rest := p.unusedArgs(); strings.Join(rest, "|") != "E=mc2|notes=x" {
+		t.Errorf("left queued %q, want the title and the unknown field", rest)
+	}
+}
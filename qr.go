@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// qrVersion describes the size and error correction layout of one QR code
+// version at error correction level M, which survives about 15% damage.
+type qrVersion struct {
+	Total     int   // Total is the number of codewords in the symbol
+	ECPer     int   // ECPer is the number of error correction codewords per block
+	Blocks    int   // Blocks is the number of error correction blocks
+	Alignment []int // Alignment are the row/column centres of the alignment patterns
+}
+
+// qrVersions are versions 1 to 6; card numbers need version 1. Versions 7
+// and up need extra version information, which we don't draw.
+var qrVersions = []qrVersion{
+	{Total: 26, ECPer: 10, Blocks: 1},
+	{Total: 44, ECPer: 16, Blocks: 1, Alignment: []int{6, 18}},
+	{Total: 70, ECPer: 26, Blocks: 1, Alignment: []int{6, 22}},
+	{Total: 100, ECPer: 18, Blocks: 2, Alignment: []int{6, 26}},
+	{Total: 134, ECPer: 24, Blocks: 2, Alignment: []int{6, 30}},
+	{Total: 172, ECPer: 16, Blocks: 4, Alignment: []int{6, 34}},
+}
+
+// qrCode is a finished symbol; Modules[y][x] is true for a dark module.
+type qrCode struct {
+	Size    int
+	Modules [][]bool
+}
+
+// qrBuilder holds a symbol while it is drawn.
+type qrBuilder struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // function marks modules that are part of the fixed patterns, not data
+}
+
+// encodeQR encodes data in byte mode at error correction level M, in the
+// smallest version it fits, with the mask that scores best.
+func encodeQR(data []byte) (qrCode, error) {
+	number := 0
+	for i, v := range qrVersions {
+		dataCodewords := v.Total - v.ECPer*v.Blocks
+		if 4+8+8*len(data) <= dataCodewords*8 { // Mode, length and data bits
+			number = i + 1
+			break
+		}
+	}
+	if number == 0 {
+		return qrCode{}, errors.New("too much data for a QR code")
+	}
+	version := qrVersions[number-1]
+	codewords := qrAddErrorCorrection(qrDataCodewords(data, version), version)
+
+	b := newQRBuilder(number)
+	b.drawFunctionPatterns(version)
+	b.drawCodewords(codewords)
+
+	// Try each mask and keep the one with the lowest penalty
+	best, bestPenalty := 0, math.MaxInt
+	for mask := 0; mask < 8; mask++ {
+		b.applyMask(mask)
+		b.drawFormatBits(mask)
+		if penalty := b.penalty(); penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		b.applyMask(mask) // Masking twice undoes it
+	}
+	b.applyMask(best)
+	b.drawFormatBits(best)
+	return qrCode{Size: b.size, Modules: b.modules}, nil
+}
+
+// qrDataCodewords packs data into byte mode with its header and padding.
+func qrDataCodewords(data []byte, version qrVersion) []byte {
+	capacity := version.Total - version.ECPer*version.Blocks
+	bits := []bool{}
+	appendBits := func(value, count int) {
+		for i := count - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+	appendBits(0b0100, 4) // Byte mode
+	appendBits(len(data), 8)
+	for _, c := range data {
+		appendBits(int(c), 8)
+	}
+	appendBits(0, min(4, capacity*8-len(bits))) // Terminator
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var c byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				c |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, c)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// qrAddErrorCorrection splits data into blocks, adds Reed-Solomon codewords
+// to each and interleaves the blocks as the symbol stores them.
+func qrAddErrorCorrection(data []byte, version qrVersion) []byte {
+	shortLen := len(data) / version.Blocks
+	longBlocks := len(data) % version.Blocks // The last blocks are one codeword longer
+	divisor := qrDivisor(version.ECPer)
+
+	dataBlocks, ecBlocks := [][]byte{}, [][]byte{}
+	start := 0
+	for i := 0; i < version.Blocks; i++ {
+		n := shortLen
+		if i >= version.Blocks-longBlocks {
+			n++
+		}
+		block := data[start : start+n]
+		start += n
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, qrRemainder(block, divisor))
+	}
+
+	result := []byte{}
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < version.ECPer; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies in GF(256) with the QR code polynomial.
+func qrMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ byte((int(z)>>7)*0x1D)
+		z ^= ((y >> i) & 1) * x
+	}
+	return z
+}
+
+// qrDivisor returns the Reed-Solomon generator polynomial of the given degree,
+// highest coefficient first and without the leading 1.
+func qrDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrRemainder returns the error correction codewords for data.
+func qrRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= qrMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+func newQRBuilder(version int) *qrBuilder {
+	size := 17 + 4*version
+	b := &qrBuilder{size: size}
+	for i := 0; i < size; i++ {
+		b.modules = append(b.modules, make([]bool, size))
+		b.function = append(b.function, make([]bool, size))
+	}
+	return b
+}
+
+func (b *qrBuilder) set(x, y int, dark bool) {
+	b.modules[y][x] = dark
+	b.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format information area.
+func (b *qrBuilder) drawFunctionPatterns(version qrVersion) {
+	for i := 0; i < b.size; i++ {
+		b.set(6, i, i%2 == 0)
+		b.set(i, 6, i%2 == 0)
+	}
+	for _, centre := range [][2]int{{3, 3}, {b.size - 4, 3}, {3, b.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := centre[0]+dx, centre[1]+dy
+				if x >= 0 && x < b.size && y >= 0 && y < b.size {
+					dist := max(abs(dx), abs(dy))
+					b.set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+	last := len(version.Alignment) - 1
+	for i, cy := range version.Alignment {
+		for j, cx := range version.Alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // These would overlap the finder patterns
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					b.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	b.drawFormatBits(0) // Reserves the area; the real mask is drawn later
+}
+
+// drawFormatBits draws both copies of the error correction level (M) and mask.
+func (b *qrBuilder) drawFormatBits(mask int) {
+	data := 0<<3 | mask // Level M is 00
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		b.set(8, i, bit(i))
+	}
+	b.set(8, 7, bit(6))
+	b.set(8, 8, bit(7))
+	b.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		b.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		b.set(b.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		b.set(8, b.size-15+i, bit(i))
+	}
+	b.set(8, b.size-8, true) // The dark module
+}
+
+// drawCodewords fills the data area in the zigzag order of the standard.
+func (b *qrBuilder) drawCodewords(codewords []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vert := 0; vert < b.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = b.size - 1 - vert
+				}
+				if !b.function[y][x] && i < len(codewords)*8 {
+					b.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by mask.
+func (b *qrBuilder) applyMask(mask int) {
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !b.function[y][x] {
+				b.modules[y][x] = !b.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan; lower is better.
+func (b *qrBuilder) penalty() int {
+	score := 0
+	line := func(get func(i int) bool) {
+		// Runs of five or more modules of one colour
+		run := 1
+		for i := 1; i <= b.size; i++ {
+			if i < b.size && get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				score += 3 + run - 5
+			}
+			run = 1
+		}
+		// Patterns that look like a finder: dark-light-dark-dark-dark-light-dark with four light on one side
+		for i := 0; i+11 <= b.size; i++ {
+			pattern := ""
+			for j := i; j < i+11; j++ {
+				if get(j) {
+					pattern += "1"
+				} else {
+					pattern += "0"
+				}
+			}
+			if pattern == "10111010000" || pattern == "00001011101" {
+				score += 40
+			}
+		}
+	}
+	for y := 0; y < b.size; y++ {
+		line(func(x int) bool { return b.modules[y][x] })
+	}
+	for x := 0; x < b.size; x++ {
+		line(func(y int) bool { return b.modules[y][x] })
+	}
+
+	dark := 0
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			if b.modules[y][x] {
+				dark++
+			}
+			// 2x2 blocks of one colour
+			if x+1 < b.size && y+1 < b.size {
+				c := b.modules[y][x]
+				if b.modules[y][x+1] == c && b.modules[y+1][x] == c && b.modules[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	// Balance of dark and light
+	percent := dark * 100 / (b.size * b.size)
+	score += abs(percent-50) / 5 * 10
+	return score
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var historyFile = ".library_history" // historyFile keeps the commands typed in earlier sessions
+const historyLimit = 500             // historyLimit is how many commands the history keeps
+
+// lineHistory is an in-memory list of entered lines for the arrow keys.
+// It implements term.History.
+type lineHistory struct {
+	entries []string // entries are oldest first
+	path    string   // path is the file new entries are appended to, "" for no file
+}
+
+// loadHistory reads the history file, keeping only the newest historyLimit entries.
+func loadHistory(path string) *lineHistory {
+	h := &lineHistory{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h // No history yet
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+		// Rewrite the file so it doesn't grow forever
+		os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	}
+	return h
+}
+
+// Add records entry unless it is empty or repeats the previous one.
+func (h *lineHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return // Losing history is not worth interrupting the user for
+	}
+	defer file.Close()
+	fmt.Fprintln(file, entry)
+}
+
+// Len returns the number of entries.
+func (h *lineHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns an entry, 0 being the newest.
+func (h *lineHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// completer implements Tab completion for one prompt. The typed text is
+// completed to the longest prefix shared by the matching candidates; pressing
+// Tab again when nothing more can be added cycles through the matches.
+type completer struct {
+	candidates []string
+	matches    []string // matches are the candidates found by the last Tab
+	index      int      // index is the match shown by the last cycling Tab
+}
+
+func (c *completer) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || len(c.candidates) == 0 {
+		if key != '\t' {
+			c.matches = nil // Typing anything else starts a new completion
+		}
+		return "", 0, false
+	}
+
+	// Cycling: the line is one of the previous matches, so show the next one
+	if len(c.matches) > 1 && c.index >= 0 && line == c.matches[c.index] {
+		c.index = (c.index + 1) % len(c.matches)
+		return c.matches[c.index], len(c.matches[c.index]), true
+	}
+
+	prefix := strings.ToLower(line[:pos])
+	c.matches = c.matches[:0]
+	for _, candidate := range c.candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), prefix) {
+			c.matches = append(c.matches, candidate)
+		}
+	}
+	if len(c.matches) == 0 {
+		return "", 0, false
+	}
+
+	common := c.matches[0]
+	for _, match := range c.matches[1:] {
+		common = commonPrefixFold(common, match)
+	}
+	if len(common) > pos || len(c.matches) == 1 {
+		c.index = -1
+		return common, len(common), true
+	}
+	c.index = 0
+	return c.matches[0], len(c.matches[0]), true
+}
+
+// commonPrefixFold returns the longest prefix of a that b also starts with, ignoring case.
+func commonPrefixFold(a, b string) string {
+	ar, br := []rune(a), []rune(b)
+	n := 0
+	for n < len(ar) && n < len(br) && strings.EqualFold(string(ar[n]), string(br[n])) {
+		n++
+	}
+	return string(ar[:n])
+}
+
+// newTerminalPrompter returns a prompter with line editing, history and Tab
+// completion. It fails when stdin is not a terminal, e.g. when input is piped.
+func newTerminalPrompter() (*prompter, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return nil, errors.New("not a terminal")
+	}
+	commands := loadHistory(historyFile)
+	answers := &lineHistory{} // Answers to other prompts are only remembered for this session
+
+	// One editor for the whole session: it keeps input it read ahead, such as
+	// the rest of several pasted lines, for the next prompt. Whatever is
+	// printed between prompts ends with a newline, so its idea of the cursor
+	// (back at the start of a line after Enter) stays right.
+	newEditor := func() *term.Terminal {
+		return term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, "")
+	}
+	editor := newEditor()
+
+	readLine := func(req lineRequest) (string, error) {
+		// The line editor can't draw a prompt that spans lines, so print leading newlines first
+		label := strings.TrimLeft(req.label, "\n")
+		fmt.Print(req.label[:len(req.label)-len(label)])
+
+		state, err := term.MakeRaw(in)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(in, state)
+
+		editor.SetPrompt(label)
+		if width, height, err := term.GetSize(out); err == nil {
+			editor.SetSize(width, height)
+		}
+		editor.History = answers
+		if req.command {
+			editor.History = commands
+		}
+		c := &completer{candidates: req.completions}
+		editor.AutoCompleteCallback = c.complete
+
+		line, err := editor.ReadLine()
+		if err == io.EOF {
+			fmt.Print("\r\n") // Ctrl-C and Ctrl-D leave the cursor on the prompt line
+			// They also leave the editor mid-line, so the next prompt gets a new one
+			editor = newEditor()
+		}
+		return line, err
+	}
+	return &prompter{readLine: readLine, out: os.Stdout}, nil
+}
+
+// newConsolePrompter uses the line editor when possible and plain line reading otherwise.
+func newConsolePrompter() *prompter {
+	if p, err := newTerminalPrompter(); err == nil {
+		return p
+	}
+	return newPrompter(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// receipt is one RENT or RETURN transaction, as the receipt templates see it.
+type receipt struct {
+	Kind      string // Kind is "rent" or "return"
+	Time      time.Time
+	Visitor   Visitor
+	Items     []receiptItem
+	Category  string   // Category is the name of the visitor's category
+	Rules     Category // Rules are the borrowing rules of that category
+	Fees      FeeRules
+	TotalFine int // TotalFine is the late fees charged in this transaction, in cents
+	Balance   int // Balance is what the visitor owes after it
+}
+
+// receiptItem is one book rented or returned.
+type receiptItem struct {
+	Book    Book
+	Barcode string
+	Due     time.Time // Due is when the book must be back, or for a return when it was due
+	Fine    int       // Fine is the late fee charged on return
+}
+
+// lastReceipt is the last RENT or RETURN of this session, for RECEIPT.
+var lastReceipt *receipt
+
+// newReceipt starts a receipt of kind "rent" or "return".
+func newReceipt(kind string) *receipt {
+	return &receipt{Kind: kind, Time: clock.Now()}
+}
+
+// finish fills in the visitor's state after the transaction.
+func (r *receipt) finish(vid int) {
+	r.Visitor = visitors[vid]
+	r.Category, r.Rules = visitorCategory(r.Visitor)
+	r.Fees = feeRules
+	r.Balance = balance(vid)
+	for _, item := range r.Items {
+		r.TotalFine += item.Fine
+	}
+}
+
+// The built-in receipt templates.
+const receiptTextTemplate = `{{if eq .Kind "rent"}}LOAN RECEIPT{{else}}RETURN RECEIPT{{end}}
+{{.Time.Format "2006-01-02 15:04"}}
+
+Visitor: {{.Visitor.Name}}{{with .Visitor.Card}} (card {{.}}){{end}}
+{{range .Items}}
+{{.Book.Title}} by {{.Book.Author}}{{with .Barcode}}, copy {{.}}{{end}}
+{{- if eq $.Kind "rent"}}
+  Due back {{date .Due}}
+{{- else}}
+  Returned{{if .Fine}}, late fee {{money .Fine}}{{end}}
+{{- end}}
+{{end}}
+{{len .Items}} book(s){{if .TotalFine}}, late fees {{money .TotalFine}}{{end}}
+{{- if .Balance}}
+Balance owed: {{money .Balance}}
+{{- end}}
+
+Loans last {{.Rules.LoanDays}} days and can be renewed {{.Rules.Renewals}} time(s) unless someone else is waiting.
+Late books cost {{money .Fees.DailyRate}} a day{{if .Fees.MaxPerLoan}}, at most {{money .Fees.MaxPerLoan}} per book{{end}}.
+Thank you for visiting the library.
+`
+
+const receiptHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if eq .Kind "rent"}}Loan receipt{{else}}Return receipt{{end}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; max-width: 40em; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3em 0.5em; border-bottom: 1px solid #ccc; }
+.policy { font-size: 0.9em; color: #444; }
+</style>
+</head>
+<body>
+<h1>{{if eq .Kind "rent"}}Loan receipt{{else}}Return receipt{{end}}</h1>
+<p>{{.Time.Format "2006-01-02 15:04"}}<br>
+Visitor: {{.Visitor.Name}}{{with .Visitor.Card}} (card {{.}}){{end}}</p>
+<table>
+<tr><th>Book</th><th>Copy</th><th>{{if eq .Kind "rent"}}Due back{{else}}Late fee{{end}}</th></tr>
+{{- range .Items}}
+<tr><td>{{.Book.Title}} by {{.Book.Author}}</td><td>{{.Barcode}}</td><td>{{if eq $.Kind "rent"}}{{date .Due}}{{else if .Fine}}{{money .Fine}}{{end}}</td></tr>
+{{- end}}
+</table>
+<p>{{len .Items}} book(s){{if .TotalFine}}, late fees {{money .TotalFine}}{{end}}.
+{{- if .Balance}} Balance owed: {{money .Balance}}.{{end}}</p>
+<p class="policy">Loans last {{.Rules.LoanDays}} days and can be renewed {{.Rules.Renewals}} time(s)
+unless someone else is waiting. Late books cost {{money .Fees.DailyRate}} a day
+{{- if .Fees.MaxPerLoan}}, at most {{money .Fees.MaxPerLoan}} per book{{end}}.
+Thank you for visiting the library.</p>
+</body>
+</html>
+`
+
+// receiptText renders r with the text template.
+func receiptText(r *receipt) (string, error) {
+	tmpl, err := loadTemplate("receipt.txt.tmpl", receiptTextTemplate)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, r); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// receiptPages lays out text on A4 pages in a monospaced font, wrapping
+// lines too long for the page.
+func receiptPages(text string) []labelPage {
+	const margin, fontSize, lineHeight = 20.0, 3.5, 5.0
+	const maxChars = 80     // Courier is 0.6 em wide, so this fits between the margins
+	const linesPerPage = 51 // (sheetHeight - 2*margin) / lineHeight, rounded down
+
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		for utf8.RuneCountInString(line) > maxChars {
+			runes := []rune(line)
+			cut := maxChars
+			if space := strings.LastIndex(string(runes[:maxChars]), " "); space > 0 {
+				cut = utf8.RuneCountInString(string(runes[:maxChars])[:space])
+			}
+			lines = append(lines, string(runes[:cut]))
+			line = strings.TrimLeft(string(runes[cut:]), " ")
+		}
+		lines = append(lines, line)
+	}
+
+	pages := []labelPage{}
+	for i, line := range lines {
+		if i%linesPerPage == 0 {
+			pages = append(pages, labelPage{})
+		}
+		y := margin + float64(i%linesPerPage+1)*lineHeight
+		pages[len(pages)-1] = append(pages[len(pages)-1], labelShape{Text: line, X: margin, Y: y, FontSize: fontSize, Monospaced: true})
+	}
+	return pages
+}
+
+// writeReceipt saves r at path as text, HTML or PDF, depending on its extension.
+func writeReceipt(r *receipt, path string) error {
+	var out bytes.Buffer
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".txt":
+		text, err := receiptText(r)
+		if err != nil {
+			return err
+		}
+		out.WriteString(text)
+	case ".html", ".htm":
+		tmpl, err := loadHTMLTemplate("receipt.html.tmpl", receiptHTMLTemplate)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(&out, r); err != nil {
+			return err
+		}
+	case ".pdf":
+		text, err := receiptText(r)
+		if err != nil {
+			return err
+		}
+		if err := writePDF(&out, receiptPages(text)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown receipt format %q, use a .txt, .html or .pdf file", ext)
+	}
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// handleReceipt shows the receipt of the last RENT or RETURN, or saves it.
+func handleReceipt(p *prompter) error {
+	if lastReceipt == nil {
+		return errors.New("nothing rented or returned yet in this session")
+	}
+	path, err := p.line("Output file (.txt, .html or .pdf, Enter to show it here): ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		text, err := receiptText(lastReceipt)
+		if err != nil {
+			return err
+		}
+		fmt.Print(text)
+		p.waitForReturn()
+		return nil
+	}
+	if err := writeReceipt(lastReceipt, path); err != nil {
+		return fmt.Errorf("writing receipt: %w", err)
+	}
+	fmt.Printf("Receipt for %s written to %s.\n", lastReceipt.Visitor.Name, path)
+	return nil
+}
+
+// nextTransactionBook asks for the next book of a RENT or RETURN. The first
+// is required; more are taken from the command line, or asked for at the
+// menu until Enter. done is true when there are no more.
+func nextTransactionBook(p *prompter, verb string, first, fromArgs bool) (bid int, barcode string, done bool, err error) {
+	if !first {
+		if fromArgs {
+			if !p.hasArgs() {
+				return 0, "", true, nil
+			}
+		} else {
+			text, err := p.line(fmt.Sprintf("Another book or barcode to %s (Enter to finish): ", verb))
+			if err != nil {
+				return 0, "", false, err
+			}
+			if text == "" {
+				return 0, "", true, nil
+			}
+			p.setArgs([]string{text}) // Let bookOrBarcode read it, titles and all
+		}
+	}
+	bid, barcode, err = p.bookOrBarcode(fmt.Sprintf("Book ID or barcode to %s: ", verb))
+	return bid, barcode, false, err
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder kinds; each has its own template and is logged separately.
+const (
+	reminderOverdue = "overdue"
+	reminderDueSoon = "due soon"
+)
+
+// ReminderSettings decide when reminders are sent and how.
+type ReminderSettings struct {
+	Notifier    string       `json:"notifier"`      // Notifier is "stdout", "file" or "smtp"
+	Outbox      string       `json:"outbox"`        // Outbox is the directory the file notifier writes to
+	DueSoonDays int          `json:"due_soon_days"` // DueSoonDays is how many days before the due date the "due soon" notice goes out
+	RepeatDays  int          `json:"repeat_days"`   // RepeatDays is how often an overdue reminder is repeated
+	SMTP        SMTPSettings `json:"smtp"`
+}
+
+// SMTPSettings say how to reach the mail server. Any server will do, including
+// a local fake one such as MailHog for trying reminders out.
+type SMTPSettings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username,omitempty"` // Username is empty for servers without login
+	Password string `json:"password,omitempty"` // Password can also be given in the LIBRARY_SMTP_PASSWORD environment variable
+	From     string `json:"from"`               // From is the sender address, e.g. library@example.org
+}
+
+var remindersFile = "reminders.json" // remindersFile can change the reminder settings
+var reminderSettings = ReminderSettings{
+	Notifier:    "stdout",
+	Outbox:      "outbox",
+	DueSoonDays: 2,
+	RepeatDays:  7,
+	SMTP:        SMTPSettings{Host: "localhost", Port: 25, From: "library@localhost"},
+}
+
+// SentReminder records one loan a reminder was sent about, so it isn't sent again too soon.
+type SentReminder struct {
+	VisitorID int       `json:"visitor_id"`
+	BookID    int       `json:"book_id"`
+	Due       time.Time `json:"due"`  // Due is the due date the reminder was about; renewing starts afresh
+	Kind      string    `json:"kind"` // Kind is reminderOverdue or reminderDueSoon
+	Sent      time.Time `json:"sent"`
+}
+
+var sentReminders []SentReminder              // sentReminders are all reminders sent, oldest first
+var sentRemindersFile = "reminders-sent.json" // sentRemindersFile is where sentReminders are stored
+
+func loadReminderSettings() {
+	data, err := os.ReadFile(remindersFile)
+	if err != nil {
+		return // The defaults apply
+	}
+	settings := reminderSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		fmt.Println("Error reading reminder settings, using the defaults:", err)
+		return
+	}
+	if settings.DueSoonDays < 0 || settings.RepeatDays < 1 {
+		fmt.Printf("Ignoring %s: due_soon_days must not be negative and repeat_days must be at least 1\n", remindersFile)
+		return
+	}
+	reminderSettings = settings
+}
+
+func loadSentReminders() {
+	sentReminders = nil
+	data, err := os.ReadFile(sentRemindersFile)
+	if err != nil {
+		return // Nothing sent yet
+	}
+	if err := json.Unmarshal(data, &sentReminders); err != nil {
+		fmt.Println("Error reading sent reminders:", err)
+	}
+}
+
+func saveSentReminders() {
+	if dryRunMode {
+		fmt.Println("(dry run) sent reminders not saved")
+		return
+	}
+	data, err := json.MarshalIndent(sentReminders, "", "  ")
+	if err != nil {
+		fmt.Println("Error saving sent reminders:", err)
+		return
+	}
+	if err := os.WriteFile(sentRemindersFile, data, 0644); err != nil {
+		fmt.Println("Error writing sent reminders file:", err)
+	}
+}
+
+// lastReminder returns when the last reminder of kind was sent about
+// visitor vid's loan, or the zero time.
+func lastReminder(vid int, loan Loan, kind string) time.Time {
+	var last time.Time
+	for _, r := range sentReminders {
+		if r.VisitorID == vid && r.BookID == loan.BookID && r.Due.Equal(loan.Due) && r.Kind == kind && r.Sent.After(last) {
+			last = r.Sent
+		}
+	}
+	return last
+}
+
+// Notice is one reminder for one visitor, ready to be sent.
+type Notice struct {
+	Visitor Visitor
+	Kind    string
+	Loans   []Loan // Loans are the loans the notice is about
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notices, e.g. by email.
+type Notifier interface {
+	Notify(n Notice) error
+}
+
+// errNoAddress is returned by notifiers that can't reach a visitor at all;
+// such notices are skipped rather than counted as failures.
+var errNoAddress = errors.New("no email address")
+
+// stdoutNotifier prints notices, e.g. to post them by hand.
+type stdoutNotifier struct {
+	out io.Writer
+}
+
+func (s stdoutNotifier) Notify(n Notice) error {
+	_, err := fmt.Fprintf(s.out, "To: %s\nSubject: %s\n\n%s\n%s\n", noticeRecipient(n.Visitor), n.Subject, strings.TrimRight(n.Body, "\n"), strings.Repeat("-", 40))
+	return err
+}
+
+// fileNotifier saves each notice as an .eml file in a directory, which mail
+// programs can open and send.
+type fileNotifier struct {
+	dir string
+}
+
+func (f fileNotifier) Notify(n Notice) error {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-visitor%d-%s.eml", clock.Now().Format("20060102-150405"), n.Visitor.ID, strings.ReplaceAll(n.Kind, " ", "-"))
+	return os.WriteFile(filepath.Join(f.dir, name), composeEmail(n, reminderSettings.SMTP.From), 0644)
+}
+
+// smtpNotifier sends notices by email, using STARTTLS when the server offers it.
+type smtpNotifier struct {
+	settings SMTPSettings
+}
+
+func (s smtpNotifier) Notify(n Notice) error {
+	if n.Visitor.Email == "" {
+		return errNoAddress
+	}
+	var auth smtp.Auth
+	if s.settings.Username != "" {
+		password := s.settings.Password
+		if env := os.Getenv("LIBRARY_SMTP_PASSWORD"); env != "" {
+			password = env
+		}
+		auth = smtp.PlainAuth("", s.settings.Username, password, s.settings.Host)
+	}
+	addr := net.JoinHostPort(s.settings.Host, strconv.Itoa(s.settings.Port))
+	return smtp.SendMail(addr, auth, s.settings.From, []string{n.Visitor.Email}, composeEmail(n, s.settings.From))
+}
+
+// newNotifier returns the notifier chosen in the settings.
+func newNotifier(settings ReminderSettings) (Notifier, error) {
+	switch settings.Notifier {
+	case "stdout", "":
+		return stdoutNotifier{out: os.Stdout}, nil
+	case "file":
+		return fileNotifier{dir: settings.Outbox}, nil
+	case "smtp":
+		if settings.SMTP.Host == "" || settings.SMTP.From == "" {
+			return nil, fmt.Errorf("set smtp host and from in %s to send email", remindersFile)
+		}
+		return smtpNotifier{settings: settings.SMTP}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q in %s, use stdout, file or smtp", settings.Notifier, remindersFile)
+}
+
+// noticeRecipient is the visitor's name and email address for the To line.
+func noticeRecipient(v Visitor) string {
+	if v.Email == "" {
+		return v.Name + " (no email address)"
+	}
+	return (&mail.Address{Name: v.Name, Address: v.Email}).String()
+}
+
+// composeEmail turns a notice into a plain text email message.
+func composeEmail(n Notice, from string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", (&mail.Address{Name: "Library", Address: from}).String())
+	if n.Visitor.Email != "" { // Left out for letters to visitors without email
+		fmt.Fprintf(&b, "To: %s\r\n", (&mail.Address{Name: n.Visitor.Name, Address: n.Visitor.Email}).String())
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", clock.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.TrimRight(n.Body, "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// The built-in reminder templates. The first line is the subject.
+const overdueTemplate = `Subject: Overdue {{if eq (len .Loans) 1}}book{{else}}books{{end}} at the library
+
+Dear {{.Visitor.Name}},
+
+{{if eq (len .Loans) 1}}This book is{{else}}These books are{{end}} overdue:
+{{- range .Loans}}
+  - {{.Book.Title}} by {{.Book.Author}}, due {{date .Due}}, {{.DaysLate}} day(s) late{{if .Fine}} ({{money .Fine}} so far){{end}}
+{{- end}}
+
+Please bring {{if eq (len .Loans) 1}}it{{else}}them{{end}} back as soon as you can.
+
+Your library
+`
+
+const dueSoonTemplate = `Subject: {{if eq (len .Loans) 1}}A book is{{else}}Books are{{end}} due back soon
+
+Dear {{.Visitor.Name}},
+
+A reminder that {{if eq (len .Loans) 1}}this book is{{else}}these books are{{end}} due back soon:
+{{- range .Loans}}
+  - {{.Book.Title}} by {{.Book.Author}}, due {{date .Due}}
+{{- end}}
+
+You can renew {{if eq (len .Loans) 1}}it{{else}}them{{end}} at the desk unless someone else is waiting.
+
+Your library
+`
+
+// reminderLoan is one loan as the reminder templates see it.
+type reminderLoan struct {
+	Book     Book
+	Barcode  string
+	Due      time.Time
+	DaysLate int // DaysLate counts every started day since the due date, as fines do; 0 if not overdue
+	Fine     int // Fine is the late fee so far, in cents
+}
+
+// reminderData is what the reminder templates are executed with.
+type reminderData struct {
+	Visitor Visitor
+	Loans   []reminderLoan
+	Today   time.Time
+}
+
+// renderNotice fills in the template for kind and splits off the subject.
+func renderNotice(v Visitor, kind string, loans []Loan, now time.Time) (Notice, error) {
+	name, builtin := "overdue.tmpl", overdueTemplate
+	if kind == reminderDueSoon {
+		name, builtin = "due-soon.tmpl", dueSoonTemplate
+	}
+	tmpl, err := loadTemplate(name, builtin)
+	if err != nil {
+		return Notice{}, err
+	}
+	data := reminderData{Visitor: v, Today: now}
+	for _, loan := range loans {
+		late := 0
+		if now.After(loan.Due) {
+			late = int(math.Ceil(now.Sub(loan.Due).Hours() / 24))
+		}
+		data.Loans = append(data.Loans, reminderLoan{Book: books[loan.BookID], Barcode: loan.Barcode, Due: loan.Due, DaysLate: late, Fine: lateFine(loan, now)})
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return Notice{}, err
+	}
+	header, body, _ := strings.Cut(out.String(), "\n\n")
+	subject, found := strings.CutPrefix(header, "Subject:")
+	if !found || strings.Contains(header, "\n") {
+		return Notice{}, fmt.Errorf("template %s must start with a \"Subject:\" line and a blank line", name)
+	}
+	return Notice{Visitor: v, Kind: kind, Loans: loans, Subject: strings.TrimSpace(subject), Body: body}, nil
+}
+
+// composeReminders returns the notices due at now: for every visitor, one
+// about the loans that are overdue and one about those due within the next
+// few days, leaving out loans reminded about recently.
+func composeReminders(now time.Time) ([]Notice, error) {
+	notices := []Notice{}
+	soon := now.AddDate(0, 0, reminderSettings.DueSoonDays)
+	for _, vid := range sortedVisitorIDs() {
+		v := visitors[vid]
+		overdue, dueSoon := []Loan{}, []Loan{}
+		for _, loan := range v.Loans {
+			switch {
+			case now.After(loan.Due):
+				last := lastReminder(vid, loan, reminderOverdue)
+				if last.IsZero() || !now.Before(last.AddDate(0, 0, reminderSettings.RepeatDays)) {
+					overdue = append(overdue, loan)
+				}
+			case !loan.Due.After(soon):
+				if lastReminder(vid, loan, reminderDueSoon).IsZero() {
+					dueSoon = append(dueSoon, loan)
+				}
+			}
+		}
+		for _, group := range []struct {
+			kind  string
+			loans []Loan
+		}{{reminderOverdue, overdue}, {reminderDueSoon, dueSoon}} {
+			if len(group.loans) == 0 {
+				continue
+			}
+			notice, err := renderNotice(v, group.kind, group.loans, now)
+			if err != nil {
+				return nil, err
+			}
+			notices = append(notices, notice)
+		}
+	}
+	return notices, nil
+}
+
+// sendReminders delivers the notices and logs the ones that went out.
+// Failures are reported and tried again next time. In dry-run mode nothing
+// is logged, so the notices still go out for real later.
+func sendReminders(notifier Notifier, notices []Notice) (sent, failed int) {
+	now := clock.Now()
+	for _, n := range notices {
+		if err := notifier.Notify(n); errors.Is(err, errNoAddress) {
+			fmt.Printf("Skipped the %s reminder to %s: %v.\n", n.Kind, n.Visitor.Name, err)
+			continue
+		} else if err != nil {
+			fmt.Printf("Could not send the %s reminder to %s: %v\n", n.Kind, n.Visitor.Name, err)
+			failed++
+			continue
+		}
+		sent++
+		if dryRunMode {
+			continue
+		}
+		for _, loan := range n.Loans {
+			sentReminders = append(sentReminders, SentReminder{VisitorID: n.Visitor.ID, BookID: loan.BookID, Due: loan.Due, Kind: n.Kind, Sent: now})
+		}
+	}
+	if sent > 0 && !dryRunMode {
+		saveSentReminders()
+	}
+	return sent, failed
+}
+
+// reminderNotifier returns the configured notifier, or stdout in dry-run
+// mode so nothing is really sent.
+func reminderNotifier() (Notifier, string, error) {
+	if dryRunMode {
+		return stdoutNotifier{out: os.Stdout}, "printing them (dry run)", nil
+	}
+	notifier, err := newNotifier(reminderSettings)
+	if err != nil {
+		return nil, "", err
+	}
+	switch reminderSettings.Notifier {
+	case "file":
+		return notifier, "saving them in " + reminderSettings.Outbox, nil
+	case "smtp":
+		return notifier, "email", nil
+	}
+	return notifier, "printing them", nil
+}
+
+func handleRemind(p *prompter) error {
+	notifier, how, err := reminderNotifier()
+	if err != nil {
+		return err
+	}
+	notices, err := composeReminders(clock.Now())
+	if err != nil {
+		return err
+	}
+	if len(notices) == 0 {
+		fmt.Println("No reminders to send.")
+		return nil
+	}
+	for _, n := range notices {
+		fmt.Printf("  %s: %s, %d book(s)\n", noticeRecipient(n.Visitor), n.Kind, len(n.Loans))
+	}
+	if err := p.confirm(fmt.Sprintf("Send %d reminder(s) by %s? (y/n): ", len(notices), how)); err != nil {
+		return err
+	}
+	sent, _ := sendReminders(notifier, notices)
+	fmt.Printf("%d of %d reminder(s) sent.\n", sent, len(notices))
+	return nil
+}
+
+// remindMain runs "library-cli remind", which sends the reminders due
+// without asking, for cron or a scheduled task. With -every it keeps
+// running and checks again after each interval, rereading the data files.
+func remindMain(args []string) int {
+	flags := flag.NewFlagSet("remind", flag.ContinueOnError)
+	every := flags.Duration("every", 0, "keep running and send reminders again after this long, e.g. 24h")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	notifier, _, err := reminderNotifier()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	for {
+		notices, err := composeReminders(clock.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			if *every == 0 {
+				return 1
+			}
+		}
+		sent, failed := sendReminders(notifier, notices)
+		fmt.Printf("%s: %d of %d reminder(s) sent.\n", clock.Now().Format("2006-01-02 15:04"), sent, len(notices))
+		if *every == 0 {
+			if failed > 0 {
+				return 1
+			}
+			return 0
+		}
+		time.Sleep(*every)
+		// The library may have been used in the meantime
+		books, visitors = make(map[int]Book), make(map[int]Visitor)
+		loadBooks()
+		loadVisitors()
+		loadSentReminders()
+	}
+}
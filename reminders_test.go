@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage is one message the fake SMTP server received.
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTPServer accepts mail on a free local port, just enough of SMTP for
+// smtp.SendMail without login or STARTTLS. It returns the port and a channel
+// with every message received.
+func fakeSMTPServer(t *testing.T) (int, <-chan smtpMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // Closed at the end of the test
+			}
+			serveSMTP(conn, messages)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake.test ESMTP")
+	msg := smtpMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 fake.test")
+		case "MAIL":
+			msg.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			messages <- msg
+			msg = smtpMessage{}
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK") // RSET, NOOP
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	testLibrary(t, testStart)
+	port, messages := fakeSMTPServer(t)
+	notifier := smtpNotifier{settings: SMTPSettings{Host: "127.0.0.1", Port: port, From: "library@example.org"}}
+
+	notice := Notice{
+		Visitor: Visitor{ID: 1, Name: "Zoë Example", Email: "zoe@example.org"},
+		Kind:    reminderOverdue,
+		Subject: "Overdue book at the library",
+		Body:    "Dear Zoë,\n\nPlease bring Dune back.\n",
+	}
+	if err := notifier.Notify(notice); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg smtpMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fake server received no message")
+	}
+	if msg.From != "library@example.org" || len(msg.To) != 1 || msg.To[0] != "zoe@example.org" {
+		t.Errorf("envelope from %q to %q", msg.From, msg.To)
+	}
+	header, body, found := strings.Cut(msg.Data, "\n\n") // ReadDotBytes turns CRLF into LF
+	if !found {
+		t.Fatalf("no blank line after the header:\n%s", msg.Data)
+	}
+	for _, want := range []string{
+		`From: "Library" <library@example.org>`,
+		"To: =?utf-8?q?Zo=C3=AB_Example?= <zoe@example.org>",
+		"Subject: Overdue book at the library",
+		"Date: " + testStart.Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(header, want+"\n") {
+			t.Errorf("header is missing %q:\n%s", want, header)
+		}
+	}
+	if want := "Dear Zoë,\n\nPlease bring Dune back.\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPNotifierNoAddress(t *testing.T) {
+	notifier := smtpNotifier{settings: SMTPSettings{Host: "127.0.0.1", Port: 1, From: "library@example.org"}}
+	err := notifier.Notify(Notice{Visitor: Visitor{ID: 1, Name: "Ada"}})
+	if !errors.Is(err, errNoAddress) {
+		t.Errorf("error = %v, want errNoAddress", err)
+	}
+}
+
+// recordingNotifier keeps the notices it is given.
+type recordingNotifier struct {
+	notices []Notice
+}
+
+func (r *recordingNotifier) Notify(n Notice) error {
+	r.notices = append(r.notices, n)
+	return nil
+}
+
+// remind composes and sends the reminders due now, as "library-cli remind" does.
+func remind(t *testing.T) []Notice {
+	t.Helper()
+	loadSentReminders() // Start from the file, like a new run from cron
+	notices, err := composeReminders(clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &recordingNotifier{}
+	if sent, failed := sendReminders(notifier, notices); sent != len(notices) || failed != 0 {
+		t.Fatalf("sent %d and failed %d of %d", sent, failed, len(notices))
+	}
+	return notifier.notices
+}
+
+func TestRemindersNotRepeated(t *testing.T) {
+	fake := testLibrary(t, testStart)
+	bid, vid := addTestBook("Dune"), addTestVisitor("Ada")
+	loan, err := rentCopy(vid, bid, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A day before the due date the "due soon" notice goes out, once
+	fake.Advance(loan.Due.Sub(fake.Now()) - 24*time.Hour)
+	if notices := remind(t); len(notices) != 1 || notices[0].Kind != reminderDueSoon {
+		t.Fatalf("notices before the due date = %+v, want one due soon", notices)
+	}
+	if notices := remind(t); len(notices) != 0 {
+		t.Fatalf("due soon notice sent again: %+v", notices)
+	}
+
+	// The day after the due date the book is overdue
+	fake.Advance(2 * 24 * time.Hour)
+	if notices := remind(t); len(notices) != 1 || notices[0].Kind != reminderOverdue {
+		t.Fatalf("notices after the due date = %+v, want one overdue", notices)
+	}
+
+	data, err := os.ReadFile(sentRemindersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []SentReminder
+	if err := json.Unmarshal(data, &logged); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 2 || logged[1].Kind != reminderOverdue || !logged[1].Sent.Equal(fake.Now()) {
+		t.Errorf("%s = %+v, want the due soon and overdue reminders", sentRemindersFile, logged)
+	}
+
+	// Within the repeat interval nothing is sent again
+	fake.Advance(time.Duration(reminderSettings.RepeatDays)*24*time.Hour - time.Minute)
+	if notices := remind(t); len(notices) != 0 {
+		t.Fatalf("overdue notice repeated after %d days: %+v", reminderSettings.RepeatDays, notices)
+	}
+	fake.Advance(time.Minute)
+	if notices := remind(t); len(notices) != 1 || notices[0].Kind != reminderOverdue {
+		t.Fatalf("notices after the repeat interval = %+v, want one overdue", notices)
+	}
+}
+
+func TestRemindersNotLoggedInDryRun(t *testing.T) {
+	fake := testLibrary(t, testStart)
+	bid, vid := addTestBook("Dune"), addTestVisitor("Ada")
+	loan, err := rentCopy(vid, bid, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(loan.Due.Sub(fake.Now()) + 24*time.Hour)
+
+	dryRunMode = true
+	t.Cleanup(func() { dryRunMode = false })
+	notices := remind(t)
+	dryRunMode = false
+	if len(notices) != 1 {
+		t.Fatalf("dry run notices = %+v, want one overdue", notices)
+	}
+	if len(sentReminders) != 0 {
+		t.Errorf("dry run logged %+v", sentReminders)
+	}
+	// The real run afterwards still sends the notice
+	if notices := remind(t); len(notices) != 1 {
+		t.Errorf("notices after the dry run = %+v, want one overdue", notices)
+	}
+}
+
+func TestRemindersSkipVisitorsWithoutEmail(t *testing.T) {
+	fake := testLibrary(t, testStart)
+	bid, vid := addTestBook("Dune"), addTestVisitor("Ada")
+	loan, err := rentCopy(vid, bid, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(loan.Due.Sub(fake.Now()) + 24*time.Hour)
+
+	notices, err := composeReminders(fake.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := smtpNotifier{settings: SMTPSettings{Host: "127.0.0.1", Port: 1, From: "library@example.org"}}
+	if sent, failed := sendReminders(notifier, notices); sent != 0 || failed != 0 {
+		t.Errorf("sent %d, failed %d; want the notice skipped", sent, failed)
+	}
+	if len(sentReminders) != 0 {
+		t.Errorf("skipped notice was logged: %+v", sentReminders)
+	}
+}
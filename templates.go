@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// templatesDir holds user-edited copies of the built-in templates. A file
+// there, e.g. templates/overdue.tmpl, replaces the built-in one of that name.
+var templatesDir = "templates"
+
+// builtinTemplates are the templates TEMPLATES writes out for editing.
+var builtinTemplates = []struct {
+	Name string
+	Text string
+}{
+	{"overdue.tmpl", overdueTemplate},
+	{"due-soon.tmpl", dueSoonTemplate},
+	{"receipt.txt.tmpl", receiptTextTemplate},
+	{"receipt.html.tmpl", receiptHTMLTemplate},
+}
+
+// templateFuncs are the helpers templates can use besides Go's built-in ones.
+var templateFuncs = map[string]any{
+	"date":  func(t time.Time) string { return formatDate(t) },
+	"money": formatMoney,
+}
+
+// readTemplate returns the text of templates/name if it exists, or else builtin.
+func readTemplate(name, builtin string) (text, path string, err error) {
+	path = filepath.Join(templatesDir, name)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		return string(data), path, nil
+	case errors.Is(err, os.ErrNotExist):
+		return builtin, path, nil
+	}
+	return "", path, err
+}
+
+// loadTemplate parses templates/name if it exists, or else builtin.
+func loadTemplate(name, builtin string) (*template.Template, error) {
+	text, path, err := readTemplate(name, builtin)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// loadHTMLTemplate is loadTemplate for HTML, which escapes what it fills in.
+func loadHTMLTemplate(name, builtin string) (*htmltemplate.Template, error) {
+	text, path, err := readTemplate(name, builtin)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// handleTemplates writes the built-in templates to templatesDir so they can
+// be edited. Templates already there are left alone.
+func handleTemplates(p *prompter) error {
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return err
+	}
+	for _, t := range builtinTemplates {
+		path := filepath.Join(templatesDir, t.Name)
+		if _, err := os.Stat(path); err == nil {
+			fmt.Printf("%s already exists, left as it is.\n", path)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(t.Text), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s.\n", path)
+	}
+	fmt.Println("Edit them to change reminders and receipts; delete one to go back to the built-in text.")
+	return nil
+}
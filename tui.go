@@ -0,0 +1,543 @@
+package main
+
+/*
+	The full-screen terminal UI. It draws three panes with ANSI escape codes:
+
+		+----------------------+----------------------+
+		| Books (search)       | Book details         |
+		|                      +----------------------+
+		|                      | Visitors             |
+		+----------------------+----------------------+
+		| status / prompt line                        |
+		+---------------------------------------------+
+
+	The terminal is put into raw mode so every key press arrives immediately.
+	All changes go through the same functions as the menu commands
+	(rentBookTo, returnBookFrom, editBook), so the data files stay identical.
+	Those print messages such as "(dry run) visitors not saved" to stdout;
+	the UI catches them with captureOutput and shows them on the status line.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	paneBooks = iota
+	paneVisitors
+)
+
+const (
+	escClear      = "\033[2J"
+	escHome       = "\033[H"
+	escClearLine  = "\033[K"
+	escHideCursor = "\033[?25l"
+	escShowCursor = "\033[?25h"
+	escAltScreen  = "\033[?1049h"
+	escMainScreen = "\033[?1049l"
+	escReverse    = "\033[7m"
+	escBold       = "\033[1m"
+)
+
+const tuiHelp = "Tab switch pane  / search  r rent  t return  e edit  q quit"
+
+// tui holds the state of the full-screen interface between key presses.
+type tui struct {
+	in     *bufio.Reader
+	out    *bufio.Writer
+	width  int
+	height int
+
+	focus     int    // focus is paneBooks or paneVisitors
+	query     string // query filters the book list as it is typed
+	searching bool   // searching is true while keys go to the search box
+	status    string // status is the message shown on the bottom line
+
+	bookIDs       []int // bookIDs are the books matching query, in ID order
+	bookCursor    int
+	bookOffset    int
+	visitorIDs    []int
+	visitorCursor int
+	visitorOffset int
+}
+
+// runTUI takes over the terminal until the user quits.
+func runTUI() error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("the full-screen UI needs an interactive terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	t := &tui{
+		in:     bufio.NewReader(os.Stdin),
+		out:    bufio.NewWriter(os.Stdout),
+		status: tuiHelp,
+	}
+	t.out.WriteString(escAltScreen + escClear + escHideCursor)
+	defer func() {
+		t.out.WriteString(escShowCursor + escMainScreen)
+		t.out.Flush()
+	}()
+
+	t.refresh()
+	for {
+		t.draw()
+		key, err := t.readKey()
+		if err != nil {
+			return err
+		}
+		if !t.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// refresh rebuilds the filtered lists and keeps the cursors in range.
+func (t *tui) refresh() {
+	t.bookIDs = t.bookIDs[:0]
+	for _, id := range sortedBookIDs() {
+		book := books[id]
+		if matchesQuery(book.Title, t.query) || matchesQuery(book.Author, t.query) {
+			t.bookIDs = append(t.bookIDs, id)
+		}
+	}
+	t.visitorIDs = sortedVisitorIDs()
+	t.bookCursor = clamp(t.bookCursor, 0, len(t.bookIDs)-1)
+	t.visitorCursor = clamp(t.visitorCursor, 0, len(t.visitorIDs)-1)
+}
+
+func clamp(n, low, high int) int {
+	if n > high {
+		n = high
+	}
+	if n < low {
+		n = low
+	}
+	return n
+}
+
+func (t *tui) selectedBook() (Book, bool) {
+	if len(t.bookIDs) == 0 {
+		return Book{}, false
+	}
+	book, exists := books[t.bookIDs[t.bookCursor]]
+	return book, exists
+}
+
+func (t *tui) selectedVisitor() (Visitor, bool) {
+	if len(t.visitorIDs) == 0 {
+		return Visitor{}, false
+	}
+	visitor, exists := visitors[t.visitorIDs[t.visitorCursor]]
+	return visitor, exists
+}
+
+// handleKey applies one key press. It returns false when the UI should close.
+func (t *tui) handleKey(key string) bool {
+	if t.searching {
+		switch key {
+		case "enter", "esc":
+			t.searching = false
+			t.status = tuiHelp
+		case "backspace":
+			if t.query != "" {
+				_, size := utf8.DecodeLastRuneInString(t.query)
+				t.query = t.query[:len(t.query)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.query += key
+			}
+		}
+		t.bookCursor = 0
+		t.refresh()
+		return true
+	}
+
+	switch key {
+	case "q", "ctrl-c":
+		return false
+	case "tab":
+		t.focus = (t.focus + 1) % 2
+	case "up", "k":
+		t.moveCursor(-1)
+	case "down", "j":
+		t.moveCursor(1)
+	case "pgup":
+		t.moveCursor(-t.listHeight())
+	case "pgdn":
+		t.moveCursor(t.listHeight())
+	case "/":
+		t.searching = true
+		t.focus = paneBooks
+	case "esc":
+		t.query = ""
+		t.refresh()
+	case "r":
+		t.rentSelected()
+	case "t":
+		t.returnSelected()
+	case "e":
+		t.editSelected()
+	}
+	return true
+}
+
+func (t *tui) moveCursor(delta int) {
+	if t.focus == paneBooks {
+		t.bookCursor = clamp(t.bookCursor+delta, 0, len(t.bookIDs)-1)
+	} else {
+		t.visitorCursor = clamp(t.visitorCursor+delta, 0, len(t.visitorIDs)-1)
+	}
+}
+
+func (t *tui) rentSelected() {
+	book, okBook := t.selectedBook()
+	visitor, okVisitor := t.selectedVisitor()
+	if !okBook || !okVisitor {
+		t.status = "Select a book and a visitor first."
+		return
+	}
+	var err error
+	output := captureOutput(func() { err = rentBookTo(visitor.ID, book.ID) })
+	if err != nil {
+		t.status = "Could not rent book: " + err.Error() + output
+		return
+	}
+	t.status = fmt.Sprintf("%s rented %q.", visitor.Name, book.Title) + output
+}
+
+func (t *tui) returnSelected() {
+	book, okBook := t.selectedBook()
+	visitor, okVisitor := t.selectedVisitor()
+	if !okBook || !okVisitor {
+		t.status = "Select a book and a visitor first."
+		return
+	}
+	var info returnInfo
+	var err error
+	output := captureOutput(func() { info, err = returnBookFrom(visitor.ID, book.ID) })
+	if err != nil {
+		t.status = "Could not return book: " + err.Error() + output
+		return
+	}
+	t.status = fmt.Sprintf("%s returned %q.", visitor.Name, book.Title)
+	if info.Fine > 0 {
+		t.status += fmt.Sprintf(" Late fee %s.", formatMoney(info.Fine))
+	}
+	for _, hold := range info.Holds {
+		t.status += fmt.Sprintf(" On hold for %s until %s.", visitors[hold.VisitorID].Name, hold.PickupBy.Format("2006-01-02"))
+	}
+	t.status += output
+}
+
+func (t *tui) editSelected() {
+	book, ok := t.selectedBook()
+	if !ok {
+		t.status = "No book selected."
+		return
+	}
+	title, ok := t.promptLine("Title: ", book.Title)
+	if !ok {
+		t.status = "Edit cancelled."
+		return
+	}
+	author, ok := t.promptLine("Author: ", book.Author)
+	if !ok {
+		t.status = "Edit cancelled."
+		return
+	}
+	var err error
+	output := captureOutput(func() { _, err = editBook(book.ID, map[string]string{"title": title, "author": author}) })
+	if err != nil {
+		t.status = "Could not update book: " + err.Error() + output
+		return
+	}
+	t.refresh()
+	t.status = "Book updated." + output
+}
+
+// escSequence matches the colour codes some messages are printed with.
+var escSequence = regexp.MustCompile("\033\\[[0-9;?]*[A-Za-z]")
+
+// captureOutput runs action with stdout sent to a pipe instead of the raw
+// terminal, where it would scribble over the screen. It returns what was
+// printed on one line, with a leading space, ready to append to the status.
+func captureOutput(action func()) (output string) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		action() // Messy screen rather than a lost change
+		return ""
+	}
+	printed := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		printed <- string(data)
+	}()
+
+	screen := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = screen
+		writer.Close()
+		for _, line := range strings.Split(escSequence.ReplaceAllString(<-printed, ""), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				output += " " + line
+			}
+		}
+	}()
+	action()
+	return ""
+}
+
+// promptLine edits a line of text on the status bar, starting from initial.
+// It returns false if the user pressed Esc.
+func (t *tui) promptLine(label, initial string) (string, bool) {
+	text := initial
+	for {
+		t.status = label + text + "_"
+		t.draw()
+		key, err := t.readKey()
+		if err != nil {
+			return "", false
+		}
+		switch key {
+		case "enter":
+			return text, true
+		case "esc", "ctrl-c":
+			return "", false
+		case "backspace":
+			if text != "" {
+				_, size := utf8.DecodeLastRuneInString(text)
+				text = text[:len(text)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				text += key
+			}
+		}
+	}
+}
+
+// readKey reads one key press and names it: "up", "enter", "esc", ... or the typed character.
+func (t *tui) readKey() (string, error) {
+	r, _, err := t.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case '\t':
+		return "tab", nil
+	case 127, 8:
+		return "backspace", nil
+	case 3:
+		return "ctrl-c", nil
+	case 27:
+		// A lone Esc arrives on its own; arrow keys arrive as Esc [ A in a single read
+		if t.in.Buffered() == 0 {
+			return "esc", nil
+		}
+		next, _ := t.in.ReadByte()
+		if next != '[' && next != 'O' {
+			return "esc", nil
+		}
+		code, _ := t.in.ReadByte()
+		switch code {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		case 'C':
+			return "right", nil
+		case 'D':
+			return "left", nil
+		case '5', '6':
+			t.in.ReadByte() // Trailing '~'
+			if code == '5' {
+				return "pgup", nil
+			}
+			return "pgdn", nil
+		}
+		// Unknown sequence: drop the rest of it
+		for t.in.Buffered() > 0 {
+			if b, _ := t.in.ReadByte(); b >= 0x40 && b <= 0x7e {
+				break
+			}
+		}
+		return "", nil
+	}
+	if r < 32 {
+		return "", nil
+	}
+	return string(r), nil
+}
+
+// listHeight is the number of rows available for the book list.
+func (t *tui) listHeight() int {
+	return max(t.height-4, 1)
+}
+
+// fit cuts or pads s to exactly width characters.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		if width == 1 {
+			return string(runes[:1])
+		}
+		return string(runes[:width-1]) + "~"
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// scroll returns a new offset so that cursor is visible in a window of size rows.
+func scroll(cursor, offset, rows int) int {
+	if cursor < offset {
+		return cursor
+	}
+	if cursor >= offset+rows {
+		return cursor - rows + 1
+	}
+	return offset
+}
+
+// draw renders the whole screen in one write to avoid flicker.
+func (t *tui) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	t.width, t.height = width, height
+
+	leftWidth := width / 2
+	rightWidth := width - leftWidth - 1
+	rows := t.listHeight()
+	detailRows := rows / 2
+	visitorRows := rows - detailRows - 1
+
+	// Left pane: book list
+	left := make([]string, rows)
+	t.bookOffset = scroll(t.bookCursor, t.bookOffset, rows)
+	for i := range rows {
+		n := t.bookOffset + i
+		if n >= len(t.bookIDs) {
+			left[i] = fit("", leftWidth)
+			continue
+		}
+		book := books[t.bookIDs[n]]
+		line := fit(fmt.Sprintf("%4d  %s - %s", book.ID, book.Title, book.Author), leftWidth)
+		if n == t.bookCursor {
+			line = escReverse + line + Reset
+		}
+		left[i] = line
+	}
+
+	// Right pane: book details on top, visitors below
+	right := make([]string, 0, rows)
+	details := []string{}
+	if book, ok := t.selectedBook(); ok {
+		details = append(details,
+			"Title:     "+book.Title,
+			"Author:    "+book.Author,
+			"ISBN:      "+book.ISBN,
+			"Publisher: "+book.Publisher)
+		if book.Year != 0 {
+			details = append(details, fmt.Sprintf("Year:      %d", book.Year))
+		}
+		renters := []string{}
+		for _, id := range sortedVisitorIDs() {
+			for _, bid := range visitors[id].RentedIDs {
+				if bid == book.ID {
+					renters = append(renters, visitors[id].Name)
+				}
+			}
+		}
+		if len(renters) > 0 {
+			details = append(details, "Rented by: "+strings.Join(renters, ", "))
+		} else {
+			details = append(details, "Rented by: nobody")
+		}
+	} else {
+		details = append(details, "No book selected.")
+	}
+	for i := range detailRows {
+		line := ""
+		if i < len(details) {
+			line = details[i]
+		}
+		right = append(right, fit(line, rightWidth))
+	}
+
+	right = append(right, t.header(" Visitors ", rightWidth, t.focus == paneVisitors))
+	t.visitorOffset = scroll(t.visitorCursor, t.visitorOffset, max(visitorRows, 1))
+	for i := range visitorRows {
+		n := t.visitorOffset + i
+		if n >= len(t.visitorIDs) {
+			right = append(right, fit("", rightWidth))
+			continue
+		}
+		v := visitors[t.visitorIDs[n]]
+		line := fit(fmt.Sprintf("%4d  %s (%d rented)", v.ID, v.Name, len(v.RentedIDs)), rightWidth)
+		if n == t.visitorCursor {
+			line = escReverse + line + Reset
+		}
+		right = append(right, line)
+	}
+
+	var b strings.Builder
+	b.WriteString(escHome)
+
+	listTitle := fmt.Sprintf(" Books (%d) ", len(t.bookIDs))
+	if t.query != "" || t.searching {
+		listTitle = fmt.Sprintf(" Books (%d) search: %s", len(t.bookIDs), t.query)
+		if t.searching {
+			listTitle += "_"
+		}
+	}
+	b.WriteString(t.header(listTitle, leftWidth, t.focus == paneBooks) + "|" + t.header(" Details ", rightWidth, false) + escClearLine + "\r\n")
+	for i := range rows {
+		b.WriteString(left[i] + "|" + right[i] + escClearLine + "\r\n")
+	}
+	b.WriteString(strings.Repeat("-", width) + "\r\n")
+	b.WriteString(fit(t.status, width) + escClearLine + "\r\n")
+	b.WriteString(escClearLine)
+
+	t.out.WriteString(b.String())
+	t.out.Flush()
+}
+
+// header draws a pane title, bold when the pane has focus.
+func (t *tui) header(title string, width int, focused bool) string {
+	line := fit(title+strings.Repeat("-", max(width-utf8.RuneCountInString(title), 0)), width)
+	if focused {
+		return escBold + Green + line + Reset
+	}
+	return line
+}
+
+func handleTUI(p *prompter) error {
+	if err := runTUI(); err != nil {
+		return fmt.Errorf("could not start the full-screen UI: %w", err)
+	}
+	return nil
+}
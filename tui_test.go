@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	screen := os.Stdout
+	output := captureOutput(func() {
+		fmt.Println("(dry run) visitors not saved")
+		fmt.Println(Green + "\nin colour" + Reset)
+	})
+	if want := " (dry run) visitors not saved in colour"; output != want {
+		t.Errorf("captureOutput() = %q, want %q", output, want)
+	}
+	if os.Stdout != screen {
+		t.Error("stdout was not put back")
+	}
+}
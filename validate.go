@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Maximum lengths, in characters, of the text fields we store.
+const (
+	maxTitleLength     = 300
+	maxAuthorLength    = 200
+	maxPublisherLength = 200
+	maxNameLength      = 100
+	maxEmailLength     = 254
+	maxPhoneLength     = 30
+	maxAddressLength   = 300
+	maxNotesLength     = 1000
+)
+
+// normalizeText trims s, joins runs of whitespace into one space, drops
+// control characters and converts it to Unicode NFC, so "Café" typed with a
+// combining accent is stored the same way as the precomposed "Café".
+func normalizeText(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// checkText normalizes value and checks it is present (if required) and not too long.
+// name is the field name used in the error message.
+func checkText(name, value string, required bool, maxLength int) (string, error) {
+	value = normalizeText(value)
+	if required && value == "" {
+		return "", fmt.Errorf("%s can't be empty", name)
+	}
+	if n := utf8.RuneCountInString(value); n > maxLength {
+		return "", fmt.Errorf("%s is too long (%d characters, at most %d)", name, n, maxLength)
+	}
+	return value, nil
+}
+
+// validateBook returns book with its text fields normalized, or the first problem found.
+func validateBook(book Book) (Book, error) {
+	var err error
+	if book.Title, err = checkText("title", book.Title, true, maxTitleLength); err != nil {
+		return Book{}, err
+	}
+	if book.Author, err = checkText("author", book.Author, true, maxAuthorLength); err != nil {
+		return Book{}, err
+	}
+	if book.Publisher, err = checkText("publisher", book.Publisher, false, maxPublisherLength); err != nil {
+		return Book{}, err
+	}
+	if book.ISBN != "" {
+		book.ISBN = cleanISBN(book.ISBN)
+		if !validISBN(book.ISBN) {
+			return Book{}, fmt.Errorf("%q is not a valid ISBN", book.ISBN)
+		}
+	}
+	if book.Year < 0 {
+		return Book{}, fmt.Errorf("%d is not a valid year", book.Year)
+	}
+	return book, nil
+}
+
+// validateVisitor returns v with its name and contact details normalized, or the problem found.
+func validateVisitor(v Visitor) (Visitor, error) {
+	for _, field := range []string{"name", "email", "phone", "address", "notes"} {
+		if err := setVisitorField(&v, field, getVisitorField(v, field)); err != nil {
+			return Visitor{}, err
+		}
+	}
+	return v, nil
+}
+
+// matchKey reduces text to what matters when looking for duplicates:
+// case, punctuation and spacing are ignored.
+func matchKey(s string) string {
+	s = strings.ToLower(normalizeText(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// bookKey returns the key used to detect duplicate books.
+func bookKey(title, author string) string {
+	return matchKey(title) + "\x00" + matchKey(author)
+}
+
+// findDuplicateBook returns another book with the same normalized title and author.
+func findDuplicateBook(book Book) (Book, bool) {
+	key := bookKey(book.Title, book.Author)
+	for _, id := range sortedBookIDs() {
+		other := books[id]
+		if other.ID != book.ID && bookKey(other.Title, other.Author) == key {
+			return other, true
+		}
+	}
+	return Book{}, false
+}
+
+// findDuplicateVisitor returns another visitor with the same normalized name.
+func findDuplicateVisitor(v Visitor) (Visitor, bool) {
+	key := matchKey(v.Name)
+	for _, id := range sortedVisitorIDs() {
+		other := visitors[id]
+		if other.ID != v.ID && matchKey(other.Name) == key {
+			return other, true
+		}
+	}
+	return Visitor{}, false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// visitorFields are the visitor fields PROFILE can change, in the order it asks for them.
+var visitorFields = []string{"name", "email", "phone", "address", "joined", "expires", "notes"}
+
+// visitorFieldLabels are the names shown in prompts.
+var visitorFieldLabels = map[string]string{
+	"name":    "Name",
+	"email":   "Email",
+	"phone":   "Phone",
+	"address": "Address",
+	"joined":  "Joined",
+	"expires": "Expires",
+	"notes":   "Notes",
+}
+
+// dateLayout is how dates are typed and shown.
+const dateLayout = "2006-01-02"
+
+// getVisitorField returns a field of v as text, "" when it is not set.
+func getVisitorField(v Visitor, field string) string {
+	switch field {
+	case "name":
+		return v.Name
+	case "email":
+		return v.Email
+	case "phone":
+		return v.Phone
+	case "address":
+		return v.Address
+	case "joined":
+		return formatDate(v.Joined)
+	case "expires":
+		return formatDate(v.Expires)
+	case "notes":
+		return v.Notes
+	}
+	return ""
+}
+
+// setVisitorField parses value and stores it in the named field of v.
+// An empty value clears optional fields; the name can't be cleared. v is
+// left as it was when value is not valid.
+func setVisitorField(v *Visitor, field, value string) error {
+	value = strings.TrimSpace(value)
+	updated := *v
+	var err error
+	switch field {
+	case "name":
+		updated.Name, err = checkText("name", value, true, maxNameLength)
+	case "email":
+		updated.Email, err = checkEmail(value)
+	case "phone":
+		updated.Phone, err = checkPhone(value)
+	case "address":
+		updated.Address, err = checkText("address", value, false, maxAddressLength)
+	case "joined":
+		updated.Joined, err = parseDate(value)
+	case "expires":
+		updated.Expires, err = parseDate(value)
+	case "notes":
+		updated.Notes, err = checkText("notes", value, false, maxNotesLength)
+	default:
+		return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(visitorFields, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	*v = updated
+	return nil
+}
+
+// checkEmail returns value if it is a plain email address like ada@example.org, or "".
+func checkEmail(value string) (string, error) {
+	email, err := checkText("email", value, false, maxEmailLength)
+	if err != nil || email == "" {
+		return email, err
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return "", fmt.Errorf("%q is not a valid email address", value)
+	}
+	return email, nil
+}
+
+// checkPhone returns value if it is a phone number of at least three digits
+// and the usual punctuation, or "".
+func checkPhone(value string) (string, error) {
+	phone, err := checkText("phone", value, false, maxPhoneLength)
+	if err != nil || phone == "" {
+		return phone, err
+	}
+	digits := 0
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case !strings.ContainsRune("+-(). /", r):
+			return "", fmt.Errorf("%q is not a valid phone number", value)
+		}
+	}
+	if digits < 3 {
+		return "", fmt.Errorf("%q is not a valid phone number", value)
+	}
+	return phone, nil
+}
+
+// parseDate reads a date like 2026-10-15 in local time; "" is the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date like %s", value, clock.Now().Format(dateLayout))
+	}
+	return date, nil
+}
+
+// formatDate shows t as a date, or "" for the zero time.
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+// printVisitorDetails shows every field of v, one per line.
+func printVisitorDetails(v Visitor) {
+	fmt.Printf("Visitor %d, card %s, %s\n", v.ID, orNone(v.Card), membershipStatus(v))
+	for _, field := range visitorFields {
+		fmt.Printf("  %-8s %s\n", visitorFieldLabels[field]+":", orNone(getVisitorField(v, field)))
+	}
+}
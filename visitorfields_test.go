@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestSetVisitorFieldKeepsOldValueOnError(t *testing.T) {
+	tests := []struct {
+		field, value string
+	}{
+		{"name", ""},
+		{"email", "not an address"},
+		{"email", "Ada <ada@example.org>"},
+		{"phone", "call me"},
+		{"phone", "12"},
+		{"joined", "yesterday"},
+	}
+	for _, test := range tests {
+		before := Visitor{ID: 1, Name: "Ada", Email: "ada@example.org", Phone: "555-0100", Joined: testStart}
+		v := before
+		if err := setVisitorField(&v, test.field, test.value); err == nil {
+			t.Errorf("%s %q was accepted", test.field, test.value)
+		}
+		if got, want := getVisitorField(v, test.field), getVisitorField(before, test.field); got != want {
+			t.Errorf("after rejecting %s %q the field is %q, want %q", test.field, test.value, got, want)
+		}
+	}
+}
+
+func TestSetVisitorFieldClears(t *testing.T) {
+	v := Visitor{ID: 1, Name: "Ada", Email: "ada@example.org", Phone: "555-0100"}
+	for _, field := range []string{"email", "phone"} {
+		if err := setVisitorField(&v, field, " "); err != nil {
+			t.Errorf("clearing %s: %v", field, err)
+		}
+	}
+	if v.Email != "" || v.Phone != "" {
+		t.Errorf("email %q and phone %q were not cleared", v.Email, v.Phone)
+	}
+}